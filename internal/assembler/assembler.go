@@ -0,0 +1,359 @@
+// Package assembler compiles a subset of the Octo assembly language into
+// CHIP-8 ROMs.
+//
+// Supported are labels, :const, :alias, :macro, :byte, :org, :call, if/then,
+// if/begin/else/end, loop/again with while, sprite data and the statements
+// for every CHIP-8, SUPER-CHIP and XO-CHIP instruction.
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Origin is the address programs are loaded at.
+const Origin = 0x200
+
+// Program is an assembled ROM.
+type Program struct {
+	ROM    []byte
+	Labels map[string]uint16
+	// Lines maps the address of the first byte of each statement to its source line.
+	Lines map[uint16]int
+}
+
+// LineAddr returns the address of the first statement at or after line.
+func (p *Program) LineAddr(line int) (uint16, bool) {
+	var addr uint16
+	found := 0
+	for a, l := range p.Lines {
+		if l < line {
+			continue
+		}
+		if found == 0 || l < found || l == found && a < addr {
+			addr, found = a, l
+		}
+	}
+	return addr, found != 0
+}
+
+// Error is an assembling error at a source line.
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Assemble compiles Octo source code.
+func Assemble(src string) (*Program, error) {
+	a := &assembler{
+		tokens:  tokenize(src),
+		here:    Origin,
+		labels:  map[string]uint16{},
+		consts:  map[string]int{},
+		aliases: map[string]uint8{},
+		macros:  map[string]macro{},
+		lines:   map[uint16]int{},
+	}
+
+	err := a.assemble()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{
+		ROM:    a.rom[Origin:a.end],
+		Labels: a.labels,
+		Lines:  a.lines,
+	}, nil
+}
+
+type token struct {
+	text string
+	line int
+}
+
+// tokenize splits the source on whitespace, dropping # comments.
+func tokenize(src string) []token {
+	var tokens []token
+	for i, line := range strings.Split(src, "\n") {
+		if c := strings.Index(line, "#"); c >= 0 {
+			line = line[:c]
+		}
+		for _, f := range strings.Fields(line) {
+			tokens = append(tokens, token{text: f, line: i + 1})
+		}
+	}
+	return tokens
+}
+
+type macro struct {
+	args []string
+	body []token
+}
+
+// fixup is a reference to a label to resolve once every label is known.
+type fixup struct {
+	addr  uint16
+	label string
+	long  bool // a 16 bit address rather than the low 12 bits of an opcode
+	line  int
+}
+
+type assembler struct {
+	tokens []token
+	pos    int
+	line   int
+
+	rom     [0x10000]byte
+	here    uint16
+	end     int
+	started bool
+
+	lines map[uint16]int
+	// line of the statement being assembled, until its first byte is emitted
+	mapLine int
+
+	labels  map[string]uint16
+	consts  map[string]int
+	aliases map[string]uint8
+	macros  map[string]macro
+	fixups  []fixup
+
+	// addresses of the open loop, begin and while blocks
+	loops    []uint16
+	whiles   [][]uint16
+	branches []uint16
+	expanded int
+}
+
+func (a *assembler) errorf(format string, args ...any) error {
+	return &Error{Line: a.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (a *assembler) assemble() error {
+	for !a.done() {
+		err := a.statement()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(a.loops) > 0 {
+		return a.errorf("missing again")
+	}
+	if len(a.branches) > 0 {
+		return a.errorf("missing end")
+	}
+	// main alone doesn't emit anything
+	if a.end <= Origin {
+		return a.errorf("empty program")
+	}
+
+	for _, f := range a.fixups {
+		addr, ok := a.labels[f.label]
+		if !ok {
+			return &Error{Line: f.line, Msg: fmt.Sprintf("undefined label %q", f.label)}
+		}
+		if f.long {
+			a.rom[f.addr] = byte(addr >> 8)
+			a.rom[f.addr+1] = byte(addr)
+			continue
+		}
+		if addr > 0xFFF {
+			return &Error{Line: f.line, Msg: fmt.Sprintf("label %q out of 12 bit range", f.label)}
+		}
+		a.rom[f.addr] = a.rom[f.addr]&0xF0 | byte(addr>>8)
+		a.rom[f.addr+1] = byte(addr)
+	}
+
+	return nil
+}
+
+func (a *assembler) done() bool {
+	return a.pos >= len(a.tokens)
+}
+
+func (a *assembler) next() (string, error) {
+	if a.done() {
+		return "", a.errorf("unexpected end of file")
+	}
+	t := a.tokens[a.pos]
+	a.pos++
+	a.line = t.line
+	return t.text, nil
+}
+
+func (a *assembler) peek() string {
+	if a.done() {
+		return ""
+	}
+	return a.tokens[a.pos].text
+}
+
+func (a *assembler) expect(want string) error {
+	got, err := a.next()
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return a.errorf("expected %q, found %q", want, got)
+	}
+	return nil
+}
+
+// start makes sure execution begins at main: unless main is the very first
+// thing in the program, a jump to it is emitted at the origin.
+func (a *assembler) start(label string) {
+	if a.started {
+		return
+	}
+	a.started = true
+	if label == "main" {
+		return
+	}
+	line := a.mapLine
+	a.mapLine = 0
+	a.fixups = append(a.fixups, fixup{addr: a.here, label: "main", line: a.line})
+	a.emit(0x10, 0x00)
+	a.mapLine = line
+}
+
+func (a *assembler) emit(bytes ...byte) {
+	a.start("")
+	if a.mapLine != 0 {
+		a.lines[a.here] = a.mapLine
+		a.mapLine = 0
+	}
+	for _, b := range bytes {
+		a.rom[a.here] = b
+		a.here++
+		a.end = max(a.end, int(a.here))
+	}
+}
+
+func (a *assembler) emitOp(op uint16) {
+	a.emit(byte(op>>8), byte(op))
+}
+
+// emitAddr emits an instruction taking a 12 bit address.
+func (a *assembler) emitAddr(op uint16, target string) error {
+	addr, label, err := a.address(target)
+	if err != nil {
+		return err
+	}
+	if label != "" {
+		a.start("")
+		a.fixups = append(a.fixups, fixup{addr: a.here, label: label, line: a.line})
+	} else if addr > 0xFFF {
+		return a.errorf("address %#x out of 12 bit range", addr)
+	}
+	a.emitOp(op | addr&0xFFF)
+	return nil
+}
+
+// address resolves a number or constant, or returns the label to fix up later.
+func (a *assembler) address(s string) (uint16, string, error) {
+	if addr, ok := a.labels[s]; ok {
+		return addr, "", nil
+	}
+	v, err := a.value(s)
+	if err == nil {
+		if v < 0 || v > 0xFFFF {
+			return 0, "", a.errorf("address %d out of range", v)
+		}
+		return uint16(v), "", nil
+	}
+	if !isName(s) {
+		return 0, "", err
+	}
+	return 0, s, nil
+}
+
+// value parses a number or a constant.
+func (a *assembler) value(s string) (int, error) {
+	if v, ok := a.consts[s]; ok {
+		return v, nil
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(s, "-")
+
+	var v int64
+	var err error
+	switch {
+	case strings.HasPrefix(digits, "0x"), strings.HasPrefix(digits, "0X"):
+		v, err = strconv.ParseInt(digits[2:], 16, 32)
+	case strings.HasPrefix(digits, "0b"), strings.HasPrefix(digits, "0B"):
+		v, err = strconv.ParseInt(digits[2:], 2, 32)
+	default:
+		v, err = strconv.ParseInt(digits, 10, 32)
+	}
+	if err != nil {
+		return 0, a.errorf("invalid number %q", s)
+	}
+	if neg {
+		v = -v
+	}
+	return int(v), nil
+}
+
+// byteValue parses an 8 bit immediate, allowing negative numbers.
+func (a *assembler) byteValue(s string) (uint8, error) {
+	v, err := a.value(s)
+	if err != nil {
+		return 0, err
+	}
+	if v < -128 || v > 255 {
+		return 0, a.errorf("value %d doesn't fit in a byte", v)
+	}
+	return uint8(v), nil
+}
+
+// register parses v0-vf or an alias.
+func (a *assembler) register(s string) (uint8, bool) {
+	if r, ok := a.aliases[s]; ok {
+		return r, true
+	}
+	s = strings.ToLower(s)
+	if len(s) != 2 || s[0] != 'v' {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(s[1:], 16, 8)
+	if err != nil {
+		return 0, false
+	}
+	return uint8(r), true
+}
+
+func (a *assembler) nextRegister() (uint8, error) {
+	s, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	r, ok := a.register(s)
+	if !ok {
+		return 0, a.errorf("expected a register, found %q", s)
+	}
+	return r, nil
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || r == '-' || r == '.':
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
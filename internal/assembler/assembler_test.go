@@ -0,0 +1,222 @@
+package assembler
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // hex
+	}{
+		{"clear", "clear", "00E0"},
+		{"return", "return ;", "00EE00EE"},
+		{"machine", "exit lores hires", "00FD00FE00FF"},
+		{"scroll", "scroll-left scroll-right scroll-down 3 scroll-up 4", "00FC00FB00C300D4"},
+		{"xo-chip", "audio plane 2 pitch := v1 save v1 - v4 load v1 - v4", "F002F201F13A51425143"},
+		{"jumps", "jump 0x300 jump0 0x300 :call 0x300", "1300B3002300"},
+		{"registers", "bcd v3 saveflags v2 loadflags v2 save v5 load v5", "F333F275F285F555F565"},
+		{"sprite", "sprite v1 v2 5 sprite va vb 0", "D125DAB0"},
+		{"index", "i := 0x345 i += v3 i := hex v4 i := bighex v4", "A345F31EF429F430"},
+		{"long", "i := long 0x1234", "F0001234"},
+		{"timers", "delay := v1 buzzer := v1 v2 := delay", "F115F118F207"},
+		{"register ops", "v1 := v2 v1 |= v2 v1 &= v2 v1 ^= v2 v1 += v2 v1 -= v2 v1 >>= v2 v1 =- v2 v1 <<= v2",
+			"8120 8121 8122 8123 8124 8125 8126 8127 812E"},
+		{"immediates", "v1 := 5 v1 += 5 v1 -= 1 v1 := -1 vf := 0xFF", "6105 7105 71FF 61FF 6FFF"},
+		{"key and random", "v1 := key v1 := random 0x0F", "F10AC10F"},
+		{"if then", "if v1 == 5 then if v1 != 5 then if v1 == v2 then if v1 != v2 then",
+			"4105310591205120"},
+		{"if key", "if v1 key then if v1 -key then", "E1A1E19E"},
+		{"if less", "if v1 < 5 then", "6F058F173F01"},
+		{"if greater or equal", "if v1 >= v2 then", "8F208F173F00"},
+		{"if greater", "if v1 > 5 then", "6F058F153F01"},
+		{"if less or equal", "if v1 <= 5 then", "6F058F153F00"},
+		{"if begin else end", `
+			if v1 == 5 begin
+				v2 := 1
+			else
+				v2 := 2
+			end
+			clear`,
+			"3105 1208 6201 120A 6202 00E0"},
+		{"if begin end", "if v1 key begin clear end", "E19E 1206 00E0"},
+		{"loop while again", `
+			loop
+				v1 += 1
+				while v1 != 10
+			again`,
+			"7101 410A 1208 1200"},
+		{"nested loops", `
+			loop
+				loop
+					while v2 == 0
+				again
+				while v1 == 0
+			again`,
+			"3200 1206 1200 3100 120C 1200"},
+		{"data", "0xFF 0b1010 7 -1 :byte 0x12", "FF0A07FF12"},
+		{"const", ":const N 5 v1 := N i := N", "6105A005"},
+		{"alias", ":alias x v3 x += 1 x := vf", "730183F0"},
+		{"macro", ":macro inc r { r += 1 } inc v2 inc v3", "72017301"},
+		{"macro in macro", ":macro inc r { r += 1 } :macro twice r { inc r inc r } twice v4", "74017401"},
+		{"org", "jump 0x200 :org 0x204 clear", "1200 0000 00E0"},
+		{"comments", "clear # clear the screen\n# and return\nreturn", "00E000EE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := Assemble(": main\n" + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := hex.DecodeString(strings.Join(strings.Fields(tt.want), ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(prog.ROM) != string(want) {
+				t.Fatalf("got %X, want %X", prog.ROM, want)
+			}
+		})
+	}
+}
+
+func TestLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // hex
+	}{
+		{"forward and backward", `
+			: main
+				jump later
+			: later
+				i := data
+				:call sub
+				sub
+				jump later
+			: sub
+				return
+			: data
+				0x01 0x02`,
+			"1202 A20C 220A 220A 1202 00EE 0102"},
+		{"main not first", `
+			: sub
+				return
+			: main
+				sub`,
+			"1204 00EE 2202"},
+		{"long", `
+			: main
+				i := long data
+			: data
+				0x42`,
+			"F000 0204 42"},
+		{"label as address", `
+			: main
+				jump0 table
+			: table
+				jump main`,
+			"B202 1200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := Assemble(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := hex.DecodeString(strings.Join(strings.Fields(tt.want), ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(prog.ROM) != string(want) {
+				t.Fatalf("got %X, want %X", prog.ROM, want)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	prog, err := Assemble(": main\n\tclear\n\n\tloop\n\t\tv1 += 1\n\tagain\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[uint16]int{0x200: 2, 0x202: 5, 0x204: 6}
+	for addr, line := range want {
+		if prog.Lines[addr] != line {
+			t.Errorf("line of %04X: got %d, want %d", addr, prog.Lines[addr], line)
+		}
+	}
+	if addr, ok := prog.LineAddr(3); !ok || addr != 0x202 {
+		t.Errorf("address of line 3: got %04X, %v", addr, ok)
+	}
+	if _, ok := prog.LineAddr(7); ok {
+		t.Error("address of a line past the end")
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+		want string
+	}{
+		{"empty", "", 0, "empty program"},
+		{"only main", ": main", 1, "empty program"},
+		{"only main and org", ": main :org 0x300", 1, "empty program"},
+		{"only labels", ": main\n: other\n:const N 1", 3, "empty program"},
+		{"undefined label", ": main\njump nowhere", 2, `undefined label "nowhere"`},
+		{"undefined main", "clear", 1, `undefined label "main"`},
+		{"duplicate label", ": main\n: main", 2, `label "main" already defined`},
+		{"invalid label", ": 1abc", 1, `invalid label "1abc"`},
+		{"byte range", ": main\nv1 := 256", 2, "value 256 doesn't fit in a byte"},
+		{"nibble range", ": main\nsprite v1 v2 16", 2, "value 16 doesn't fit in a nibble"},
+		{"address range", ": main\ni := 0x1000", 2, "address 0x1000 out of 12 bit range"},
+		{"label range", ": main\njump later\n:org 0x1000\n: later", 2, `label "later" out of 12 bit range`},
+		{"origin range", ": main\n:org 0x100", 2, "origin 0x100 out of range"},
+		{"unknown statement", ": main\nfoo!", 2, `unknown statement "foo!"`},
+		{"unknown operator", ": main\nv1 *= v2", 2, `unknown operator "*="`},
+		{"operator needs register", ": main\nv1 |= 1", 2, `operator "|=" needs a register`},
+		{"unknown comparison", ": main\nif v1 ~ 2 then", 2, `unknown comparison "~"`},
+		{"missing then", ": main\nif v1 == 2 clear", 2, `expected then or begin, found "clear"`},
+		{"expected register", ": main\nbcd 5", 2, `expected a register, found "5"`},
+		{"bad index", ": main\ni -= v1", 2, `expected := or += after i, found "-="`},
+		{"bad timer", ": main\ndelay = v1", 2, `expected ":=", found "="`},
+		{"invalid number", ": main\n:byte 0xZZ", 2, `invalid number "0xZZ"`},
+		{"end of file", ": main\nv1 +=", 2, "unexpected end of file"},
+		{"missing again", ": main\nloop", 2, "missing again"},
+		{"missing end", ": main\nif v1 == 1 begin", 2, "missing end"},
+		{"else without begin", ": main\nelse", 2, "else without begin"},
+		{"end without begin", ": main\nend", 2, "end without begin"},
+		{"while outside loop", ": main\nwhile v1 == 1", 2, "while outside of a loop"},
+		{"again without loop", ": main\nagain", 2, "again without loop"},
+		{"missing brace", ":macro m { clear", 1, `missing } for macro "m"`},
+		{"recursive macro", ":macro m { m }\n: main\nm", 3, "too many macro expansions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Assemble(tt.src)
+			var aerr *Error
+			if !errors.As(err, &aerr) {
+				t.Fatalf("got %v, want an *Error", err)
+			}
+			if aerr.Line != tt.line || aerr.Msg != tt.want {
+				t.Fatalf("got line %d: %s, want line %d: %s", aerr.Line, aerr.Msg, tt.line, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzAssemble(f *testing.F) {
+	f.Add(": main clear")
+	f.Add(": main :org 0x300")
+	f.Add(": sub return : main loop sub while v1 != 3 again")
+	f.Add(":macro m x { if x == 1 begin x += 1 else x := 0 end } : main m v2 i := long main")
+	f.Fuzz(func(t *testing.T, src string) {
+		Assemble(src)
+	})
+}
@@ -0,0 +1,653 @@
+package assembler
+
+// maxExpansions bounds macro expansion, catching macros that invoke themselves.
+const maxExpansions = 10000
+
+var negated = map[string]string{
+	"==":   "!=",
+	"!=":   "==",
+	"key":  "-key",
+	"-key": "key",
+	"<":    ">=",
+	">=":   "<",
+	">":    "<=",
+	"<=":   ">",
+}
+
+// condition is the test of an if or while statement.
+type condition struct {
+	x       uint8
+	op      string
+	operand string
+}
+
+func (a *assembler) statement() error {
+	tok, err := a.next()
+	if err != nil {
+		return err
+	}
+	a.mapLine = a.line
+
+	switch tok {
+	case ":":
+		return a.label()
+	case ":const":
+		return a.constant()
+	case ":alias":
+		return a.alias()
+	case ":macro":
+		return a.macro()
+	case ":byte":
+		return a.data()
+	case ":org":
+		return a.org()
+	case ":call":
+		return a.simple(func(s string) error { return a.emitAddr(0x2000, s) })
+
+	case "clear":
+		a.emitOp(0x00E0)
+	case "return", ";":
+		a.emitOp(0x00EE)
+	case "exit":
+		a.emitOp(0x00FD)
+	case "lores":
+		a.emitOp(0x00FE)
+	case "hires":
+		a.emitOp(0x00FF)
+	case "scroll-left":
+		a.emitOp(0x00FC)
+	case "scroll-right":
+		a.emitOp(0x00FB)
+	case "audio":
+		a.emitOp(0xF002)
+	case "scroll-down":
+		return a.nibble(0x00C0, 0)
+	case "scroll-up":
+		return a.nibble(0x00D0, 0)
+	case "plane":
+		return a.nibble(0xF001, 8)
+	case "jump":
+		return a.simple(func(s string) error { return a.emitAddr(0x1000, s) })
+	case "jump0":
+		return a.simple(func(s string) error { return a.emitAddr(0xB000, s) })
+	case "bcd":
+		return a.registerOp(0xF033)
+	case "saveflags":
+		return a.registerOp(0xF075)
+	case "loadflags":
+		return a.registerOp(0xF085)
+	case "save":
+		return a.saveLoad(0xF055, 0x5002)
+	case "load":
+		return a.saveLoad(0xF065, 0x5003)
+	case "sprite":
+		return a.sprite()
+	case "i":
+		return a.index()
+	case "delay":
+		return a.timer(0xF015)
+	case "buzzer":
+		return a.timer(0xF018)
+	case "pitch":
+		return a.timer(0xF03A)
+
+	case "if":
+		return a.ifStatement()
+	case "else":
+		return a.elseStatement()
+	case "end":
+		return a.endStatement()
+	case "loop":
+		a.start("")
+		a.loops = append(a.loops, a.here)
+		a.whiles = append(a.whiles, nil)
+	case "while":
+		return a.while()
+	case "again":
+		return a.again()
+
+	default:
+		if x, ok := a.register(tok); ok {
+			return a.assignment(x)
+		}
+		if m, ok := a.macros[tok]; ok {
+			return a.expand(m)
+		}
+		if _, err := a.value(tok); err == nil {
+			a.pos--
+			return a.data()
+		}
+		if isName(tok) {
+			return a.emitAddr(0x2000, tok)
+		}
+		return a.errorf("unknown statement %q", tok)
+	}
+
+	return nil
+}
+
+func (a *assembler) simple(f func(string) error) error {
+	s, err := a.next()
+	if err != nil {
+		return err
+	}
+	return f(s)
+}
+
+func (a *assembler) label() error {
+	name, err := a.next()
+	if err != nil {
+		return err
+	}
+	if !isName(name) {
+		return a.errorf("invalid label %q", name)
+	}
+	if _, ok := a.labels[name]; ok {
+		return a.errorf("label %q already defined", name)
+	}
+	a.start(name)
+	a.labels[name] = a.here
+	return nil
+}
+
+func (a *assembler) constant() error {
+	name, err := a.next()
+	if err != nil {
+		return err
+	}
+	if !isName(name) {
+		return a.errorf("invalid constant %q", name)
+	}
+	s, err := a.next()
+	if err != nil {
+		return err
+	}
+	v, err := a.value(s)
+	if err != nil {
+		return err
+	}
+	a.consts[name] = v
+	return nil
+}
+
+func (a *assembler) alias() error {
+	name, err := a.next()
+	if err != nil {
+		return err
+	}
+	if !isName(name) {
+		return a.errorf("invalid alias %q", name)
+	}
+	r, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	a.aliases[name] = r
+	return nil
+}
+
+func (a *assembler) macro() error {
+	name, err := a.next()
+	if err != nil {
+		return err
+	}
+	if !isName(name) {
+		return a.errorf("invalid macro %q", name)
+	}
+
+	var m macro
+	for {
+		arg, err := a.next()
+		if err != nil {
+			return err
+		}
+		if arg == "{" {
+			break
+		}
+		m.args = append(m.args, arg)
+	}
+
+	depth := 1
+	for {
+		if a.done() {
+			return a.errorf("missing } for macro %q", name)
+		}
+		t := a.tokens[a.pos]
+		a.pos++
+		switch t.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		m.body = append(m.body, t)
+	}
+
+	a.macros[name] = m
+	return nil
+}
+
+// expand replaces a macro invocation with the body of the macro.
+func (a *assembler) expand(m macro) error {
+	a.expanded++
+	if a.expanded > maxExpansions {
+		return a.errorf("too many macro expansions")
+	}
+
+	args := map[string]string{}
+	for _, name := range m.args {
+		v, err := a.next()
+		if err != nil {
+			return err
+		}
+		args[name] = v
+	}
+
+	body := make([]token, len(m.body))
+	for i, t := range m.body {
+		if v, ok := args[t.text]; ok {
+			t.text = v
+		}
+		// errors point at the invocation
+		t.line = a.line
+		body[i] = t
+	}
+
+	rest := append(body, a.tokens[a.pos:]...)
+	a.tokens = append(a.tokens[:a.pos], rest...)
+	return nil
+}
+
+func (a *assembler) data() error {
+	s, err := a.next()
+	if err != nil {
+		return err
+	}
+	v, err := a.byteValue(s)
+	if err != nil {
+		return err
+	}
+	a.emit(v)
+	return nil
+}
+
+func (a *assembler) org() error {
+	s, err := a.next()
+	if err != nil {
+		return err
+	}
+	v, err := a.value(s)
+	if err != nil {
+		return err
+	}
+	if v < Origin || v > 0xFFFF {
+		return a.errorf("origin %#x out of range", v)
+	}
+	a.start("")
+	a.here = uint16(v)
+	return nil
+}
+
+// nibble emits op with a 4 bit operand at the given shift.
+func (a *assembler) nibble(op uint16, shift int) error {
+	s, err := a.next()
+	if err != nil {
+		return err
+	}
+	n, err := a.value(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > 0xF {
+		return a.errorf("value %d doesn't fit in a nibble", n)
+	}
+	a.emitOp(op | uint16(n)<<shift)
+	return nil
+}
+
+// registerOp emits an FX__ instruction.
+func (a *assembler) registerOp(op uint16) error {
+	x, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	a.emitOp(op | uint16(x)<<8)
+	return nil
+}
+
+// saveLoad emits FX55/FX65, or the XO-CHIP 5XY2/5XY3 for "vx - vy" ranges.
+func (a *assembler) saveLoad(op, rangeOp uint16) error {
+	x, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	if a.peek() != "-" {
+		a.emitOp(op | uint16(x)<<8)
+		return nil
+	}
+	a.pos++
+	y, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	a.emitOp(rangeOp | uint16(x)<<8 | uint16(y)<<4)
+	return nil
+}
+
+func (a *assembler) sprite() error {
+	x, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	y, err := a.nextRegister()
+	if err != nil {
+		return err
+	}
+	return a.nibble(0xD000|uint16(x)<<8|uint16(y)<<4, 0)
+}
+
+func (a *assembler) index() error {
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case "+=":
+		return a.registerOp(0xF01E)
+	case ":=":
+	default:
+		return a.errorf("expected := or += after i, found %q", op)
+	}
+
+	s, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch s {
+	case "hex":
+		return a.registerOp(0xF029)
+	case "bighex":
+		return a.registerOp(0xF030)
+	case "long":
+		target, err := a.next()
+		if err != nil {
+			return err
+		}
+		addr, label, err := a.address(target)
+		if err != nil {
+			return err
+		}
+		a.emitOp(0xF000)
+		if label != "" {
+			a.fixups = append(a.fixups, fixup{addr: a.here, label: label, long: true, line: a.line})
+		}
+		a.emitOp(addr)
+		return nil
+	}
+	return a.emitAddr(0xA000, s)
+}
+
+// timer emits the instructions setting delay, buzzer and pitch.
+func (a *assembler) timer(op uint16) error {
+	err := a.expect(":=")
+	if err != nil {
+		return err
+	}
+	return a.registerOp(op)
+}
+
+func (a *assembler) assignment(x uint8) error {
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+	s, err := a.next()
+	if err != nil {
+		return err
+	}
+
+	vx := uint16(x) << 8
+	if y, ok := a.register(s); ok {
+		vy := uint16(y) << 4
+		ops := map[string]uint16{
+			":=":  0x8000,
+			"|=":  0x8001,
+			"&=":  0x8002,
+			"^=":  0x8003,
+			"+=":  0x8004,
+			"-=":  0x8005,
+			">>=": 0x8006,
+			"=-":  0x8007,
+			"<<=": 0x800E,
+		}
+		code, ok := ops[op]
+		if !ok {
+			return a.errorf("unknown operator %q", op)
+		}
+		a.emitOp(code | vx | vy)
+		return nil
+	}
+
+	if op == ":=" {
+		switch s {
+		case "key":
+			a.emitOp(0xF00A | vx)
+			return nil
+		case "delay":
+			a.emitOp(0xF007 | vx)
+			return nil
+		case "random":
+			s, err = a.next()
+			if err != nil {
+				return err
+			}
+			n, err := a.byteValue(s)
+			if err != nil {
+				return err
+			}
+			a.emitOp(0xC000 | vx | uint16(n))
+			return nil
+		}
+	}
+
+	n, err := a.byteValue(s)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case ":=":
+		a.emitOp(0x6000 | vx | uint16(n))
+	case "+=":
+		a.emitOp(0x7000 | vx | uint16(n))
+	case "-=":
+		a.emitOp(0x7000 | vx | uint16(-n))
+	default:
+		return a.errorf("operator %q needs a register", op)
+	}
+	return nil
+}
+
+func (a *assembler) condition() (condition, error) {
+	x, err := a.nextRegister()
+	if err != nil {
+		return condition{}, err
+	}
+	op, err := a.next()
+	if err != nil {
+		return condition{}, err
+	}
+	if _, ok := negated[op]; !ok {
+		return condition{}, a.errorf("unknown comparison %q", op)
+	}
+
+	c := condition{x: x, op: op}
+	if op == "key" || op == "-key" {
+		return c, nil
+	}
+	c.operand, err = a.next()
+	return c, err
+}
+
+// skip emits the instructions skipping the next one when c is false.
+func (a *assembler) skip(c condition) error {
+	vx := uint16(c.x) << 8
+
+	switch c.op {
+	case "key":
+		a.emitOp(0xE0A1 | vx)
+		return nil
+	case "-key":
+		a.emitOp(0xE09E | vx)
+		return nil
+	}
+
+	y, isRegister := a.register(c.operand)
+	var n uint8
+	if !isRegister {
+		var err error
+		n, err = a.byteValue(c.operand)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch c.op {
+	case "==", "!=":
+		if isRegister {
+			op := uint16(0x9000)
+			if c.op == "!=" {
+				op = 0x5000
+			}
+			a.emitOp(op | vx | uint16(y)<<4)
+			return nil
+		}
+		op := uint16(0x4000)
+		if c.op == "!=" {
+			op = 0x3000
+		}
+		a.emitOp(op | vx | uint16(n))
+		return nil
+	}
+
+	// the other comparisons go through vf: it's set to 1 by the
+	// subtraction when there's no borrow
+	if isRegister {
+		a.emitOp(0x8F00 | uint16(y)<<4)
+	} else {
+		a.emitOp(0x6F00 | uint16(n))
+	}
+	switch c.op {
+	case "<", ">=":
+		a.emitOp(0x8F07 | uint16(c.x)<<4) // vf := vx - operand
+	case ">", "<=":
+		a.emitOp(0x8F05 | uint16(c.x)<<4) // vf := operand - vx
+	}
+	if c.op == "<" || c.op == ">" {
+		a.emitOp(0x3F01)
+	} else {
+		a.emitOp(0x3F00)
+	}
+	return nil
+}
+
+func (a *assembler) ifStatement() error {
+	c, err := a.condition()
+	if err != nil {
+		return err
+	}
+
+	block, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch block {
+	case "then":
+		return a.skip(c)
+	case "begin":
+		// skip over the jump past the block when c is true
+		c.op = negated[c.op]
+		err := a.skip(c)
+		if err != nil {
+			return err
+		}
+		a.branches = append(a.branches, a.here)
+		a.emitOp(0x1000)
+		return nil
+	}
+	return a.errorf("expected then or begin, found %q", block)
+}
+
+func (a *assembler) elseStatement() error {
+	if len(a.branches) == 0 {
+		return a.errorf("else without begin")
+	}
+	jump := a.branches[len(a.branches)-1]
+	a.branches[len(a.branches)-1] = a.here
+	a.emitOp(0x1000)
+	return a.patch(jump, a.here)
+}
+
+func (a *assembler) endStatement() error {
+	if len(a.branches) == 0 {
+		return a.errorf("end without begin")
+	}
+	jump := a.branches[len(a.branches)-1]
+	a.branches = a.branches[:len(a.branches)-1]
+	return a.patch(jump, a.here)
+}
+
+func (a *assembler) while() error {
+	if len(a.loops) == 0 {
+		return a.errorf("while outside of a loop")
+	}
+	c, err := a.condition()
+	if err != nil {
+		return err
+	}
+	c.op = negated[c.op]
+	err = a.skip(c)
+	if err != nil {
+		return err
+	}
+	i := len(a.whiles) - 1
+	a.whiles[i] = append(a.whiles[i], a.here)
+	a.emitOp(0x1000)
+	return nil
+}
+
+func (a *assembler) again() error {
+	if len(a.loops) == 0 {
+		return a.errorf("again without loop")
+	}
+	i := len(a.loops) - 1
+	start, whiles := a.loops[i], a.whiles[i]
+	a.loops, a.whiles = a.loops[:i], a.whiles[:i]
+
+	jump := a.here
+	a.emitOp(0x1000)
+	err := a.patch(jump, start)
+	if err != nil {
+		return err
+	}
+	for _, w := range whiles {
+		err := a.patch(w, a.here)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patch points the jump at addr to target.
+func (a *assembler) patch(addr, target uint16) error {
+	if target > 0xFFF {
+		return a.errorf("jump target %#x out of 12 bit range", target)
+	}
+	a.rom[addr] = 0x10 | byte(target>>8)
+	a.rom[addr+1] = byte(target)
+	return nil
+}
@@ -3,7 +3,7 @@ package backend
 import (
 	"fmt"
 
-	"github.com/ruggi/c8/internal/backend/sdl"
+	"github.com/ruggi/c8/internal/backend/headless"
 	"github.com/ruggi/c8/internal/backend/terminal"
 	"github.com/ruggi/c8/internal/display"
 	"github.com/ruggi/c8/internal/input"
@@ -20,19 +20,34 @@ type Backend interface {
 	sound.Manager
 }
 
+// Config configures the backends, each using the options that apply to it.
+type Config struct {
+	// Keymap maps the keyboard to the CHIP-8 keys, input.HexKeymap by default.
+	Keymap input.Keymap
+	// Palette is the colours of the pixels, display.Classic by default.
+	Palette  display.Palette
+	Terminal terminal.Options
+}
+
 type Type string
 
 const (
 	SDL      Type = "sdl"
 	Terminal Type = "terminal"
+	Headless Type = "headless"
 )
 
-func New(t Type, title string) (Backend, error) {
+func New(t Type, title string, cfg Config) (Backend, error) {
 	switch t {
 	case SDL:
-		return sdl.New(title)
+		return newSDL(title, cfg)
 	case Terminal:
-		return terminal.New(title)
+		opts := cfg.Terminal
+		opts.Keymap = cfg.Keymap
+		opts.Palette = cfg.Palette
+		return terminal.New(title, opts)
+	case Headless:
+		return headless.New(title)
 	default:
 		return nil, fmt.Errorf("unknown backend type: %s", t)
 	}
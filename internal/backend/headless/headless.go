@@ -0,0 +1,174 @@
+package headless
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ruggi/c8/internal/display"
+	"github.com/ruggi/c8/internal/input"
+	"github.com/ruggi/c8/internal/sound"
+)
+
+// KeyEvent presses or releases a key once the given number of frames has been rendered.
+type KeyEvent struct {
+	Frame   int   `json:"frame"`
+	Key     uint8 `json:"key"`
+	Pressed bool  `json:"pressed"`
+}
+
+// headless is a backend keeping everything in memory, for automation and tests.
+type headless struct {
+	mu       sync.RWMutex
+	fb       display.Framebuffer
+	frames   int
+	keys     input.KeysMap
+	commands []input.Command
+	script   []KeyEvent
+	buzzes   int
+	pattern  sound.Pattern
+	status   string
+}
+
+func New(title string) (*headless, error) {
+	return &headless{}, nil
+}
+
+func (h *headless) Name() string {
+	return "headless"
+}
+
+func (h *headless) Update() {}
+
+func (h *headless) Render(fb display.Framebuffer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fb = fb
+	h.frames++
+
+	// apply the scripted key events that are due
+	for len(h.script) > 0 && h.script[0].Frame <= h.frames {
+		ev := h.script[0]
+		h.keys[ev.Key&0xF] = ev.Pressed
+		h.script = h.script[1:]
+	}
+
+	return nil
+}
+
+func (h *headless) Close() {}
+
+func (h *headless) RenderStatus(msg string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status = msg
+}
+
+func (h *headless) GetKeys() input.KeysMap {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.keys
+}
+
+func (h *headless) Commands() []input.Command {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	commands := h.commands
+	h.commands = nil
+	return commands
+}
+
+func (h *headless) Buzz() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buzzes++
+	return nil
+}
+
+func (h *headless) SetPattern(p sound.Pattern) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.pattern = p
+	return nil
+}
+
+// Script queues key events to apply as frames get rendered.
+func (h *headless) Script(events []KeyEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.script = append(h.script, events...)
+	sort.SliceStable(h.script, func(i, j int) bool {
+		return h.script[i].Frame < h.script[j].Frame
+	})
+}
+
+// Command queues a command as if its hotkey was pressed.
+func (h *headless) Command(cmd input.Command) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.commands = append(h.commands, cmd)
+}
+
+// Press presses a key right away.
+func (h *headless) Press(key uint8) {
+	h.setKey(key, true)
+}
+
+// Release releases a key right away.
+func (h *headless) Release(key uint8) {
+	h.setKey(key, false)
+}
+
+func (h *headless) setKey(key uint8, pressed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.keys[key&0xF] = pressed
+}
+
+// Framebuffer returns the last rendered framebuffer.
+func (h *headless) Framebuffer() display.Framebuffer {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.fb
+}
+
+// Frames returns the number of rendered frames.
+func (h *headless) Frames() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.frames
+}
+
+// Buzzes returns the number of frames the buzzer was on.
+func (h *headless) Buzzes() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.buzzes
+}
+
+// Pattern returns the last audio pattern set.
+func (h *headless) Pattern() sound.Pattern {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.pattern
+}
+
+// Status returns the last status message shown.
+func (h *headless) Status() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.status
+}
@@ -0,0 +1,135 @@
+package headless_test
+
+import (
+	"testing"
+
+	"github.com/ruggi/c8/internal/backend"
+	"github.com/ruggi/c8/internal/backend/headless"
+	"github.com/ruggi/c8/internal/emulator"
+	"github.com/ruggi/c8/internal/input"
+	"github.com/ruggi/c8/internal/sound"
+)
+
+// load returns an emulator running rom on the backend.
+func load(t *testing.T, b backend.Backend, platform emulator.Platform, rom []byte) *emulator.Emulator {
+	t.Helper()
+
+	e := emulator.New(b, emulator.Options{Platform: platform, Quirks: platform.Quirks()})
+	if err := e.Load(rom); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestScript(t *testing.T) {
+	b, _ := headless.New("test")
+	// waits for a key, then draws its font sprite
+	rom := []byte{0xF0, 0x0A, 0xF0, 0x29, 0xD1, 0x25, 0x12, 0x06}
+	b.Script([]headless.KeyEvent{
+		{Frame: 5, Key: 5, Pressed: false},
+		{Frame: 3, Key: 5, Pressed: true},
+	})
+	e := load(t, b, emulator.VIP, rom)
+
+	if err := e.RunFrames(b, 4, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !b.GetKeys()[5] {
+		t.Fatal("key 5 not pressed after frame 3")
+	}
+	if lit(b.Framebuffer().Pixels[0][0]) {
+		t.Fatal("drawn before the key was released")
+	}
+
+	if err := e.RunFrames(b, 6, 10); err != nil {
+		t.Fatal(err)
+	}
+	if b.GetKeys()[5] {
+		t.Fatal("key 5 still pressed after frame 5")
+	}
+	if got := b.Frames(); got != 10 {
+		t.Fatalf("rendered %d frames, want 10", got)
+	}
+
+	// the 5 font sprite
+	want := []string{
+		"####",
+		"#...",
+		"####",
+		"...#",
+		"####",
+	}
+	fb := b.Framebuffer()
+	for y, row := range want {
+		for x, c := range row {
+			if lit(fb.Pixels[x][y]) != (c == '#') {
+				t.Fatalf("pixel %d,%d: got %v, want %c", x, y, lit(fb.Pixels[x][y]), c)
+			}
+		}
+	}
+}
+
+func TestPressRelease(t *testing.T) {
+	b, _ := headless.New("test")
+	b.Press(0xA)
+	if !b.GetKeys()[0xA] {
+		t.Fatal("key A not pressed")
+	}
+	b.Release(0xA)
+	if b.GetKeys()[0xA] {
+		t.Fatal("key A still pressed")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	b, _ := headless.New("test")
+	b.Command(input.SaveState)
+	b.Command(input.LoadState)
+
+	got := b.Commands()
+	if len(got) != 2 || got[0] != input.SaveState || got[1] != input.LoadState {
+		t.Fatalf("got %v", got)
+	}
+	if got := b.Commands(); len(got) != 0 {
+		t.Fatalf("commands not drained: %v", got)
+	}
+}
+
+func TestBuzzes(t *testing.T) {
+	b, _ := headless.New("test")
+	// sets the sound timer to 5
+	rom := []byte{0x60, 0x05, 0xF0, 0x18, 0x12, 0x04}
+	e := load(t, b, emulator.VIP, rom)
+	if err := e.RunFrames(b, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// the timer counts down before the buzzer is checked every frame
+	if got := b.Buzzes(); got != 4 {
+		t.Fatalf("buzzed %d frames, want 4", got)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	b, _ := headless.New("test")
+	want := sound.Pattern{
+		Buffer: [16]uint8{0xFF, 0x00, 0xF0, 0x0F, 0xAA, 0x55, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		Pitch:  0x80,
+	}
+	// sets the pitch, then loads the pattern following the program
+	rom := []byte{0x60, 0x80, 0xF0, 0x3A, 0xA2, 0x0A, 0xF0, 0x02, 0x12, 0x08}
+	rom = append(rom, want.Buffer[:]...)
+	e := load(t, b, emulator.XOCHIP, rom)
+	if err := e.RunFrames(b, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.Pattern(); got != want {
+		t.Fatalf("got pattern %v, want %v", got, want)
+	}
+}
+
+// lit reports whether a pixel is lit on any plane.
+func lit(p uint8) bool {
+	return p != 0
+}
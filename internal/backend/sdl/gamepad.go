@@ -0,0 +1,114 @@
+package sdl
+
+import (
+	"log"
+
+	"github.com/ruggi/c8/internal/input"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// stickDeadZone is how far the left stick has to be pushed to act as the D-pad.
+const stickDeadZone = 16000
+
+// gamepad is a connected game controller.
+type gamepad struct {
+	controller *sdl.GameController
+	// player is the index of the gamepad in the keymap, the lowest one not
+	// taken when it was connected
+	player  int
+	pressed map[input.Button]bool
+	// left stick position
+	x, y int16
+}
+
+// addGamepad opens the game controller with the given device index.
+func (b *sdlBackend) addGamepad(index int) {
+	if !sdl.IsGameController(index) {
+		return
+	}
+	c := sdl.GameControllerOpen(index)
+	if c == nil {
+		log.Printf("open gamepad %d: %s", index, sdl.GetError())
+		return
+	}
+	id := c.Joystick().InstanceID()
+	if _, ok := b.gamepads[id]; ok {
+		c.Close()
+		return
+	}
+
+	player := 0
+	for taken := true; taken; {
+		taken = false
+		for _, p := range b.gamepads {
+			if p.player == player {
+				taken = true
+				player++
+				break
+			}
+		}
+	}
+
+	b.gamepads[id] = &gamepad{
+		controller: c,
+		player:     player,
+		pressed:    map[input.Button]bool{},
+	}
+}
+
+// removeGamepad closes the game controller with the given instance id.
+func (b *sdlBackend) removeGamepad(id sdl.JoystickID) {
+	p, ok := b.gamepads[id]
+	if !ok {
+		return
+	}
+	p.controller.Close()
+	delete(b.gamepads, id)
+}
+
+// gamepadEvent handles the game controller events.
+func (b *sdlBackend) gamepadEvent(event sdl.Event) {
+	switch ev := event.(type) {
+	case *sdl.ControllerDeviceEvent:
+		switch ev.Type {
+		case sdl.CONTROLLERDEVICEADDED:
+			b.addGamepad(int(ev.Which))
+		case sdl.CONTROLLERDEVICEREMOVED:
+			b.removeGamepad(ev.Which)
+		}
+	case *sdl.ControllerButtonEvent:
+		if p, ok := b.gamepads[ev.Which]; ok {
+			button := input.Button(sdl.GameControllerGetStringForButton(sdl.GameControllerButton(ev.Button)))
+			p.pressed[button] = ev.State == sdl.PRESSED
+		}
+	case *sdl.ControllerAxisEvent:
+		if p, ok := b.gamepads[ev.Which]; ok {
+			switch sdl.GameControllerAxis(ev.Axis) {
+			case sdl.CONTROLLER_AXIS_LEFTX:
+				p.x = ev.Value
+			case sdl.CONTROLLER_AXIS_LEFTY:
+				p.y = ev.Value
+			}
+		}
+	}
+}
+
+// gamepadKeys adds the CHIP-8 keys held on the gamepads to keys.
+func (b *sdlBackend) gamepadKeys(keys *input.KeysMap) {
+	for _, p := range b.gamepads {
+		stick := map[input.Button]bool{
+			input.ButtonLeft:  p.x < -stickDeadZone,
+			input.ButtonRight: p.x > stickDeadZone,
+			input.ButtonUp:    p.y < -stickDeadZone,
+			input.ButtonDown:  p.y > stickDeadZone,
+		}
+		for _, button := range input.Buttons {
+			if !p.pressed[button] && !stick[button] {
+				continue
+			}
+			if key, ok := b.keymap.Button(p.player, button); ok {
+				keys[key] = true
+			}
+		}
+	}
+}
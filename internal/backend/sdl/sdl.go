@@ -3,26 +3,59 @@ package sdl
 import (
 	"fmt"
 	"math"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/ruggi/c8/internal/display"
 	"github.com/ruggi/c8/internal/input"
+	"github.com/ruggi/c8/internal/sound"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
-const scale = 10
+const (
+	scale      = 10
+	sampleRate = 44100
+)
+
+var hotkeys = map[sdl.Scancode]input.Command{
+	sdl.SCANCODE_F5: input.SaveState,
+	sdl.SCANCODE_F6: input.PrevSlot,
+	sdl.SCANCODE_F7: input.NextSlot,
+	sdl.SCANCODE_F9: input.LoadState,
+
+	sdl.SCANCODE_F4:  input.ToggleBreakpoint,
+	sdl.SCANCODE_F8:  input.TogglePause,
+	sdl.SCANCODE_F10: input.StepOver,
+	sdl.SCANCODE_F11: input.Step,
+}
+
+// rewindKey rewinds time while held
+const rewindKey = sdl.SCANCODE_BACKSPACE
+
+// Options configure the SDL backend.
+type Options struct {
+	// Keymap maps the keyboard and the gamepads to CHIP-8 keys,
+	// input.HexKeymap by default.
+	Keymap input.Keymap
+	// Palette is the colours of the pixels, display.Classic by default.
+	Palette display.Palette
+}
 
 type sdlBackend struct {
 	// display
+	title    string
+	palette  display.Palette
 	window   *sdl.Window
 	renderer *sdl.Renderer
 	texture  *sdl.Texture
 	pixels   []byte
 
 	// input
-	keys input.KeysMap
+	keymap   input.Keymap
+	keys     input.KeysMap
+	gamepads map[sdl.JoystickID]*gamepad
+	commands []input.Command
+	rewind   bool
 
 	// buzzer
 	audioDevice  sdl.AudioDeviceID
@@ -36,7 +69,14 @@ func (b *sdlBackend) Name() string {
 	return "SDL"
 }
 
-func New(title string) (*sdlBackend, error) {
+func New(title string, opts Options) (*sdlBackend, error) {
+	if opts.Keymap.Keys == nil {
+		opts.Keymap = input.HexKeymap.Keymap()
+	}
+	if opts.Palette == (display.Palette{}) {
+		opts.Palette = display.Classic.Palette()
+	}
+
 	err := sdl.Init(sdl.INIT_EVERYTHING)
 	if err != nil {
 		return nil, fmt.Errorf("init sdl: %w", err)
@@ -66,12 +106,16 @@ func New(title string) (*sdlBackend, error) {
 		return nil, fmt.Errorf("create texture: %w", err)
 	}
 
-	audioDevice, audioBytes, err := setupSDLBuzzer(44100, 0.1, 440)
+	audioDevice, audioBytes, err := setupSDLBuzzer(sampleRate, 0.1, 440)
 	if err != nil {
 		return nil, fmt.Errorf("setup buzzer: %w", err)
 	}
 
 	backend := &sdlBackend{
+		title:    title,
+		palette:  opts.Palette,
+		keymap:   opts.Keymap,
+		gamepads: map[sdl.JoystickID]*gamepad{},
 		window:   window,
 		renderer: renderer,
 		texture:  texture,
@@ -86,20 +130,26 @@ func New(title string) (*sdlBackend, error) {
 }
 
 func (b *sdlBackend) Render(fb display.Framebuffer) error {
-	b.renderer.SetDrawColor(0, 0, 0, 0xFF)
+	bg := b.palette[0]
+	b.renderer.SetDrawColor(bg.R, bg.G, bg.B, 0xFF)
 	b.renderer.Clear()
 
-	b.renderer.SetDrawColor(0xFF, 0xFF, 0xFF, 0xFF)
-	for x := range fb {
-		for y := range fb[x] {
-			if !fb[x][y] {
+	// hi-res pixels are half the size of lo-res ones
+	px := display.Width * scale / fb.Width()
+
+	for x := range fb.Width() {
+		for y := range fb.Height() {
+			v := fb.Pixels[x][y]
+			if v == 0 {
 				continue
 			}
+			c := b.palette[v&0x3]
+			b.renderer.SetDrawColor(c.R, c.G, c.B, 0xFF)
 			rect := sdl.Rect{
-				X: int32(x * scale),
-				Y: int32(y * scale),
-				W: scale,
-				H: scale,
+				X: int32(x * px),
+				Y: int32(y * px),
+				W: int32(px),
+				H: int32(px),
 			}
 			b.renderer.FillRect(&rect)
 		}
@@ -110,7 +160,19 @@ func (b *sdlBackend) Render(fb display.Framebuffer) error {
 	return nil
 }
 
+// RenderStatus shows the message in the window title.
+func (b *sdlBackend) RenderStatus(msg string) {
+	title := b.title
+	if msg != "" {
+		title += " - " + msg
+	}
+	b.window.SetTitle(title)
+}
+
 func (b *sdlBackend) Close() {
+	for id := range b.gamepads {
+		b.removeGamepad(id)
+	}
 	if b.audioDevice != 0 {
 		sdl.CloseAudioDevice(b.audioDevice)
 	}
@@ -123,50 +185,60 @@ func (b *sdlBackend) Update() {
 	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 		switch event := event.(type) {
 		case *sdl.QuitEvent:
-			os.Exit(0)
+			b.commands = append(b.commands, input.Quit)
+		case *sdl.ControllerDeviceEvent, *sdl.ControllerButtonEvent, *sdl.ControllerAxisEvent:
+			b.gamepadEvent(event)
 		case *sdl.KeyboardEvent:
 			ke := event
 			pressed := ke.Type == sdl.KEYDOWN
-			switch ke.Keysym.Scancode {
-			case sdl.SCANCODE_1, sdl.SCANCODE_KP_1:
-				b.keys[0x1] = pressed
-			case sdl.SCANCODE_2, sdl.SCANCODE_KP_2:
-				b.keys[0x2] = pressed
-			case sdl.SCANCODE_3, sdl.SCANCODE_KP_3:
-				b.keys[0x3] = pressed
-			case sdl.SCANCODE_4, sdl.SCANCODE_KP_4:
-				b.keys[0x4] = pressed
-			case sdl.SCANCODE_5, sdl.SCANCODE_KP_5:
-				b.keys[0x5] = pressed
-			case sdl.SCANCODE_6, sdl.SCANCODE_KP_6:
-				b.keys[0x6] = pressed
-			case sdl.SCANCODE_7, sdl.SCANCODE_KP_7:
-				b.keys[0x7] = pressed
-			case sdl.SCANCODE_8, sdl.SCANCODE_KP_8:
-				b.keys[0x8] = pressed
-			case sdl.SCANCODE_9, sdl.SCANCODE_KP_9:
-				b.keys[0x9] = pressed
-			case sdl.SCANCODE_0, sdl.SCANCODE_KP_0:
-				b.keys[0x0] = pressed
-			case sdl.SCANCODE_A:
-				b.keys[0xA] = pressed
-			case sdl.SCANCODE_B:
-				b.keys[0xB] = pressed
-			case sdl.SCANCODE_C:
-				b.keys[0xC] = pressed
-			case sdl.SCANCODE_D:
-				b.keys[0xD] = pressed
-			case sdl.SCANCODE_E:
-				b.keys[0xE] = pressed
-			case sdl.SCANCODE_F:
-				b.keys[0xF] = pressed
+			if pressed && ke.Repeat == 0 {
+				if cmd, ok := hotkeys[ke.Keysym.Scancode]; ok {
+					b.commands = append(b.commands, cmd)
+				}
+			}
+			if ke.Keysym.Scancode == rewindKey {
+				b.rewind = pressed
+			}
+			if r, ok := scancodeRune(ke.Keysym.Scancode); ok {
+				if key, ok := b.keymap.Key(r); ok {
+					b.keys[key] = pressed
+				}
 			}
 		}
 	}
 }
 
+// scancodeRune returns the character typed by the key with the given scancode
+// on a US layout, with the keypad typing digits.
+func scancodeRune(sc sdl.Scancode) (rune, bool) {
+	switch {
+	case sc >= sdl.SCANCODE_A && sc <= sdl.SCANCODE_Z:
+		return rune('a' + sc - sdl.SCANCODE_A), true
+	case sc >= sdl.SCANCODE_1 && sc <= sdl.SCANCODE_9:
+		return rune('1' + sc - sdl.SCANCODE_1), true
+	case sc >= sdl.SCANCODE_KP_1 && sc <= sdl.SCANCODE_KP_9:
+		return rune('1' + sc - sdl.SCANCODE_KP_1), true
+	case sc == sdl.SCANCODE_0, sc == sdl.SCANCODE_KP_0:
+		return '0', true
+	case sc == sdl.SCANCODE_SPACE:
+		return ' ', true
+	}
+	return 0, false
+}
+
 func (b *sdlBackend) GetKeys() input.KeysMap {
-	return b.keys
+	keys := b.keys
+	b.gamepadKeys(&keys)
+	return keys
+}
+
+func (b *sdlBackend) Commands() []input.Command {
+	commands := b.commands
+	if b.rewind {
+		commands = append(commands, input.Rewind)
+	}
+	b.commands = nil
+	return commands
 }
 
 func (b *sdlBackend) Buzz() error {
@@ -180,9 +252,10 @@ func (b *sdlBackend) Buzz() error {
 
 	b.rmu.Lock()
 	b.isBuzzing = true
+	audioBytes := b.audioBytes
 	b.rmu.Unlock()
 
-	err := sdl.QueueAudio(b.audioDevice, b.audioBytes)
+	err := sdl.QueueAudio(b.audioDevice, audioBytes)
 	if err != nil {
 		return fmt.Errorf("queue audio: %w", err)
 	}
@@ -201,6 +274,36 @@ func (b *sdlBackend) Buzz() error {
 	return nil
 }
 
+// SetPattern replaces the buzzer tone with the given XO-CHIP audio pattern.
+func (b *sdlBackend) SetPattern(p sound.Pattern) error {
+	audioBytes := patternAudio(p, sampleRate, b.buzzDuration)
+
+	b.rmu.Lock()
+	b.audioBytes = audioBytes
+	b.rmu.Unlock()
+
+	return nil
+}
+
+// patternAudio renders the 1-bit pattern as signed 16 bit samples.
+func patternAudio(p sound.Pattern, sampleRate int, duration float64) []byte {
+	samples := int(float64(sampleRate) * duration)
+	audioBytes := make([]byte, samples*2)
+
+	amplitude := int16(0x7FFF * 3 / 10) // 30% volume
+	step := p.Rate() / float64(sampleRate)
+	for i := range samples {
+		sample := -amplitude
+		if p.Sample(int(float64(i) * step)) {
+			sample = amplitude
+		}
+		audioBytes[i*2] = byte(sample & 0xFF)
+		audioBytes[i*2+1] = byte((sample >> 8) & 0xFF)
+	}
+
+	return audioBytes
+}
+
 func setupSDLBuzzer(sampleRate int, duration, frequency float64) (sdl.AudioDeviceID, []byte, error) {
 	samples := int(float64(sampleRate) * duration)
 	audioBuffer := make([]int16, samples)
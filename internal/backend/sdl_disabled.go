@@ -0,0 +1,10 @@
+//go:build nosdl
+
+package backend
+
+import "fmt"
+
+// newSDL fails when building with the nosdl tag, e.g. for containers without the SDL library.
+func newSDL(title string, cfg Config) (Backend, error) {
+	return nil, fmt.Errorf("SDL backend not available, build without the nosdl tag")
+}
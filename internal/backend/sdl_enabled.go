@@ -0,0 +1,9 @@
+//go:build !nosdl
+
+package backend
+
+import "github.com/ruggi/c8/internal/backend/sdl"
+
+func newSDL(title string, cfg Config) (Backend, error) {
+	return sdl.New(title, sdl.Options{Keymap: cfg.Keymap, Palette: cfg.Palette})
+}
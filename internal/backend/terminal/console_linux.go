@@ -0,0 +1,138 @@
+package terminal
+
+import (
+	"os"
+
+	"github.com/gdamore/tcell/v2"
+	"golang.org/x/sys/unix"
+)
+
+// keyboard mode ioctls of the Linux console, from linux/kd.h
+const (
+	kdGetKeyboardMode = 0x4B44
+	kdSetKeyboardMode = 0x4B45
+	kMediumRaw        = 0x02
+)
+
+// consoleKeys are the keys with the given Linux key codes.
+var consoleKeys = map[uint8]keyEvent{
+	1:  {key: tcell.KeyEsc},
+	14: {key: tcell.KeyBackspace2},
+	28: {key: tcell.KeyEnter},
+	57: {key: tcell.KeyRune, r: ' '},
+
+	2: {key: tcell.KeyRune, r: '1'}, 3: {key: tcell.KeyRune, r: '2'}, 4: {key: tcell.KeyRune, r: '3'},
+	5: {key: tcell.KeyRune, r: '4'}, 6: {key: tcell.KeyRune, r: '5'}, 7: {key: tcell.KeyRune, r: '6'},
+	8: {key: tcell.KeyRune, r: '7'}, 9: {key: tcell.KeyRune, r: '8'}, 10: {key: tcell.KeyRune, r: '9'},
+	11: {key: tcell.KeyRune, r: '0'},
+
+	16: {key: tcell.KeyRune, r: 'q'}, 17: {key: tcell.KeyRune, r: 'w'}, 18: {key: tcell.KeyRune, r: 'e'},
+	19: {key: tcell.KeyRune, r: 'r'}, 20: {key: tcell.KeyRune, r: 't'}, 21: {key: tcell.KeyRune, r: 'y'},
+	22: {key: tcell.KeyRune, r: 'u'}, 23: {key: tcell.KeyRune, r: 'i'}, 24: {key: tcell.KeyRune, r: 'o'},
+	25: {key: tcell.KeyRune, r: 'p'}, 30: {key: tcell.KeyRune, r: 'a'}, 31: {key: tcell.KeyRune, r: 's'},
+	32: {key: tcell.KeyRune, r: 'd'}, 33: {key: tcell.KeyRune, r: 'f'}, 34: {key: tcell.KeyRune, r: 'g'},
+	35: {key: tcell.KeyRune, r: 'h'}, 36: {key: tcell.KeyRune, r: 'j'}, 37: {key: tcell.KeyRune, r: 'k'},
+	38: {key: tcell.KeyRune, r: 'l'}, 44: {key: tcell.KeyRune, r: 'z'}, 45: {key: tcell.KeyRune, r: 'x'},
+	46: {key: tcell.KeyRune, r: 'c'}, 47: {key: tcell.KeyRune, r: 'v'}, 48: {key: tcell.KeyRune, r: 'b'},
+	49: {key: tcell.KeyRune, r: 'n'}, 50: {key: tcell.KeyRune, r: 'm'},
+
+	// keypad
+	71: {key: tcell.KeyRune, r: '7'}, 72: {key: tcell.KeyRune, r: '8'}, 73: {key: tcell.KeyRune, r: '9'},
+	75: {key: tcell.KeyRune, r: '4'}, 76: {key: tcell.KeyRune, r: '5'}, 77: {key: tcell.KeyRune, r: '6'},
+	79: {key: tcell.KeyRune, r: '1'}, 80: {key: tcell.KeyRune, r: '2'}, 81: {key: tcell.KeyRune, r: '3'},
+	82: {key: tcell.KeyRune, r: '0'},
+
+	59: {key: tcell.KeyF1}, 60: {key: tcell.KeyF2}, 61: {key: tcell.KeyF3}, 62: {key: tcell.KeyF4},
+	63: {key: tcell.KeyF5}, 64: {key: tcell.KeyF6}, 65: {key: tcell.KeyF7}, 66: {key: tcell.KeyF8},
+	67: {key: tcell.KeyF9}, 68: {key: tcell.KeyF10}, 87: {key: tcell.KeyF11}, 88: {key: tcell.KeyF12},
+}
+
+// left and right control key codes
+const (
+	consoleLeftCtrl  = 29
+	consoleRightCtrl = 97
+)
+
+// consoleTty puts the Linux console in medium raw keyboard mode, where it
+// reports the key codes of presses and releases, turning them into keyEvents.
+// Nothing is passed through to tcell.
+type consoleTty struct {
+	tcell.Tty
+	f     *os.File // the console, for the keyboard mode ioctls
+	mode  int      // the keyboard mode to restore
+	onKey func(keyEvent)
+
+	ctrl [2]bool
+	buf  []byte
+	// bytes left of a key code above 127, which take three bytes
+	skip int
+}
+
+// newConsoleTty returns a consoleTty if the terminal is a Linux console.
+func newConsoleTty(tty tcell.Tty, onKey func(keyEvent)) (tcell.Tty, bool) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, false
+	}
+	mode, err := unix.IoctlGetInt(int(f.Fd()), kdGetKeyboardMode)
+	if err != nil {
+		f.Close()
+		return nil, false
+	}
+	return &consoleTty{Tty: tty, f: f, mode: mode, onKey: onKey}, true
+}
+
+func (c *consoleTty) Start() error {
+	err := c.Tty.Start()
+	if err != nil {
+		return err
+	}
+	return unix.IoctlSetInt(int(c.f.Fd()), kdSetKeyboardMode, kMediumRaw)
+}
+
+func (c *consoleTty) Stop() error {
+	unix.IoctlSetInt(int(c.f.Fd()), kdSetKeyboardMode, c.mode)
+	return c.Tty.Stop()
+}
+
+func (c *consoleTty) Close() error {
+	c.f.Close()
+	return c.Tty.Close()
+}
+
+func (c *consoleTty) Read(p []byte) (int, error) {
+	if cap(c.buf) < len(p) {
+		c.buf = make([]byte, len(p))
+	}
+	n, err := c.Tty.Read(c.buf[:len(p)])
+
+	for _, b := range c.buf[:n] {
+		if c.skip > 0 {
+			c.skip--
+			continue
+		}
+		code, pressed := b&0x7F, b&0x80 == 0
+		if code == 0 {
+			c.skip = 2
+			continue
+		}
+
+		switch code {
+		case consoleLeftCtrl:
+			c.ctrl[0] = pressed
+		case consoleRightCtrl:
+			c.ctrl[1] = pressed
+		}
+
+		ev, ok := consoleKeys[code]
+		if !ok {
+			continue
+		}
+		if ev.r == 'c' && (c.ctrl[0] || c.ctrl[1]) {
+			ev = keyEvent{key: tcell.KeyCtrlC}
+		}
+		ev.pressed = pressed
+		c.onKey(ev)
+	}
+	return 0, err
+}
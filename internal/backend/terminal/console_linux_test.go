@@ -0,0 +1,52 @@
+package terminal
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestConsoleRead(t *testing.T) {
+	release := func(r rune) keyEvent { return keyEvent{key: tcell.KeyRune, r: r} }
+
+	tests := []struct {
+		name  string
+		reads []string
+		keys  []keyEvent
+	}{
+		{"press", []string{"\x1e"}, []keyEvent{press('a')}},
+		{"release", []string{"\x1e\x9e"}, []keyEvent{press('a'), release('a')}},
+		{"repeat", []string{"\x1e\x1e\x1e\x9e"}, []keyEvent{press('a'), press('a'), press('a'), release('a')}},
+		{"keypad", []string{"\x4f\xcf\x52"}, []keyEvent{press('1'), release('1'), press('0')}},
+		{"function key", []string{"\x3b"}, []keyEvent{{key: tcell.KeyF1, pressed: true}}},
+		{"ctrl-c", []string{"\x1d\x2e"}, []keyEvent{{key: tcell.KeyCtrlC, pressed: true}}},
+		{"right ctrl-c", []string{"\x61\x2e"}, []keyEvent{{key: tcell.KeyCtrlC, pressed: true}}},
+		{"ctrl released", []string{"\x1d\x9d\x2e"}, []keyEvent{press('c')}},
+		{"unknown", []string{"\x2a\xaa"}, nil},
+		{"3 byte press", []string{"\x00\x81\x10\x1e"}, []keyEvent{press('a')}},
+		{"3 byte release", []string{"\x80\x81\x10\x9e"}, []keyEvent{release('a')}},
+		{"3 byte split", []string{"\x00", "\x81", "\x10\x1e"}, []keyEvent{press('a')}},
+		{"3 byte with key codes", []string{"\x00\x1e\x1e\x1e"}, []keyEvent{press('a')}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []keyEvent
+			c := &consoleTty{
+				Tty:   &fakeTty{reads: tt.reads},
+				onKey: func(ev keyEvent) { keys = append(keys, ev) },
+			}
+
+			if out := readAll(t, c, 64); out != "" {
+				t.Errorf("passed through %q", out)
+			}
+			if len(keys) != len(tt.keys) {
+				t.Fatalf("got keys %+v, want %+v", keys, tt.keys)
+			}
+			for i := range keys {
+				if keys[i] != tt.keys[i] {
+					t.Fatalf("got keys %+v, want %+v", keys, tt.keys)
+				}
+			}
+		})
+	}
+}
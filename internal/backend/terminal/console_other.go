@@ -0,0 +1,10 @@
+//go:build unix && !linux
+
+package terminal
+
+import "github.com/gdamore/tcell/v2"
+
+// newConsoleTty fails outside of Linux, which is the only console supported.
+func newConsoleTty(tty tcell.Tty, onKey func(keyEvent)) (tcell.Tty, bool) {
+	return nil, false
+}
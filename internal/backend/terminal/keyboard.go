@@ -0,0 +1,204 @@
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Keyboard is how the terminal backend tells when keys are released.
+type Keyboard string
+
+const (
+	// KeyboardAuto uses the raw keyboard mode of the Linux console, or the
+	// kitty keyboard protocol if the terminal supports it, falling back to a
+	// timeout.
+	KeyboardAuto Keyboard = "auto"
+	// KeyboardTimeout always releases keys after a timeout.
+	KeyboardTimeout Keyboard = "timeout"
+)
+
+// Keyboards lists the supported keyboard modes.
+var Keyboards = []Keyboard{KeyboardAuto, KeyboardTimeout}
+
+// ParseKeyboard returns the keyboard mode with the given name.
+func ParseKeyboard(name string) (Keyboard, error) {
+	for _, k := range Keyboards {
+		if string(k) == name {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown terminal keyboard: %s", name)
+}
+
+// keyEvent is a key press, repeat or release, whatever the input it comes from.
+type keyEvent struct {
+	key     tcell.Key
+	r       rune // the character when key is tcell.KeyRune
+	pressed bool
+	repeat  bool
+}
+
+// kittyFlags are the progressive enhancements of the kitty keyboard protocol
+// to enable: disambiguate escape codes (1), report event types (2) and report
+// all keys as escape codes (8), without which text keys aren't released.
+const kittyFlags = 1 | 2 | 8
+
+// kittyKeypad is the first keypad digit key code, followed by the others in order.
+const kittyKeypad = 57399
+
+// kittyTty enables the kitty keyboard protocol, turning its key events into
+// keyEvents and passing everything else through to tcell. Terminals that
+// don't support the protocol ignore it, and never answer the query for the
+// enabled flags, so that onDetect is never called.
+type kittyTty struct {
+	tcell.Tty
+	onKey    func(keyEvent)
+	onDetect func()
+	detected bool
+	buf      []byte
+	// the start of a sequence the last read ended in the middle of
+	pending []byte
+}
+
+func newKittyTty(tty tcell.Tty, onKey func(keyEvent), onDetect func()) *kittyTty {
+	return &kittyTty{Tty: tty, onKey: onKey, onDetect: onDetect}
+}
+
+func (k *kittyTty) Start() error {
+	err := k.Tty.Start()
+	if err != nil {
+		return err
+	}
+	// push the flags, then query them
+	_, err = fmt.Fprintf(k.Tty, "\x1b[>%du\x1b[?u", kittyFlags)
+	return err
+}
+
+func (k *kittyTty) Stop() error {
+	// pop the flags
+	k.Tty.Write([]byte("\x1b[<u"))
+	return k.Tty.Stop()
+}
+
+// Read filters the protocol sequences out of the input. A sequence split
+// across reads is kept until the rest of it is read.
+func (k *kittyTty) Read(p []byte) (int, error) {
+	if len(k.pending) >= len(p) {
+		// no room to read the rest, leave it to tcell
+		n := copy(p, k.pending)
+		k.pending = k.pending[:copy(k.pending, k.pending[n:])]
+		return n, nil
+	}
+	if cap(k.buf) < len(p) {
+		k.buf = make([]byte, len(p))
+	}
+	start := copy(k.buf, k.pending)
+	k.pending = k.pending[:0]
+	n, err := k.Tty.Read(k.buf[start:len(p)])
+	in := k.buf[:start+n]
+
+	out := p[:0]
+	for len(in) > 0 {
+		i := bytes.Index(in, []byte("\x1b["))
+		if i < 0 {
+			// with the protocol enabled the escape key is a sequence too, so
+			// a final escape is the start of one
+			if k.detected && err == nil && in[len(in)-1] == '\x1b' {
+				k.pending = append(k.pending, '\x1b')
+				in = in[:len(in)-1]
+			}
+			out = append(out, in...)
+			break
+		}
+		out = append(out, in[:i]...)
+		in = in[i:]
+
+		end := csiEnd(in)
+		if end < 0 && err == nil {
+			k.pending = append(k.pending, in...)
+			break
+		}
+		if end < 0 || !k.handle(string(in[2:end]), in[end]) {
+			// not ours: leave it to tcell
+			out = append(out, in[:2]...)
+			in = in[2:]
+			continue
+		}
+		in = in[end+1:]
+	}
+	return len(out), err
+}
+
+// csiEnd returns the index of the final byte of the control sequence starting
+// at seq, or -1 if it's incomplete.
+func csiEnd(seq []byte) int {
+	for i := 2; i < len(seq); i++ {
+		if b := seq[i]; b >= 0x40 && b <= 0x7E {
+			return i
+		}
+	}
+	return -1
+}
+
+// handle processes the control sequence with the given parameters and final
+// byte, reporting whether it was part of the protocol.
+func (k *kittyTty) handle(params string, final byte) bool {
+	if final != 'u' {
+		// releases and repeats of functional keys have an event type, while
+		// their presses are the legacy sequences tcell understands
+		return strings.Contains(params, ":")
+	}
+	if strings.HasPrefix(params, "?") {
+		k.detected = true
+		k.onDetect()
+		return true
+	}
+
+	fields := strings.Split(params, ";")
+	code, err := strconv.Atoi(strings.Split(fields[0], ":")[0])
+	if err != nil {
+		return false
+	}
+	mods, event := 1, 1
+	if len(fields) > 1 {
+		sub := strings.Split(fields[1], ":")
+		if m, err := strconv.Atoi(sub[0]); err == nil {
+			mods = m
+		}
+		if len(sub) > 1 {
+			if e, err := strconv.Atoi(sub[1]); err == nil {
+				event = e
+			}
+		}
+	}
+
+	ev, ok := kittyKey(code, mods-1)
+	if ok {
+		ev.pressed = event != 3
+		ev.repeat = event == 2
+		k.onKey(ev)
+	}
+	return true
+}
+
+// kittyKey returns the key with the given code and modifier bits.
+func kittyKey(code, mods int) (keyEvent, bool) {
+	const ctrl = 4
+
+	switch {
+	case code == 8, code == 9, code == 13, code == 27, code == 127:
+		return keyEvent{key: tcell.Key(code)}, true
+	case code >= kittyKeypad && code < kittyKeypad+10:
+		return keyEvent{key: tcell.KeyRune, r: rune('0' + code - kittyKeypad)}, true
+	case code >= 0xE000 && code <= 0xF8FF:
+		// other functional keys, e.g. modifiers, have private use code points
+		return keyEvent{}, false
+	case mods&ctrl != 0 && code >= 'a' && code <= 'z':
+		return keyEvent{key: tcell.KeyCtrlA + tcell.Key(code-'a')}, true
+	}
+	return keyEvent{key: tcell.KeyRune, r: rune(code)}, true
+}
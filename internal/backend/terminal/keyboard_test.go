@@ -0,0 +1,162 @@
+package terminal
+
+import (
+	"io"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// fakeTty returns the given reads, one per call, then io.EOF.
+type fakeTty struct {
+	tcell.Tty
+	reads []string
+}
+
+func (f *fakeTty) Read(p []byte) (int, error) {
+	if len(f.reads) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, f.reads[0])
+	f.reads[0] = f.reads[0][n:]
+	if f.reads[0] == "" {
+		f.reads = f.reads[1:]
+	}
+	return n, nil
+}
+
+// readAll reads r until io.EOF, returning what it passed through.
+func readAll(t *testing.T, r io.Reader, size int) string {
+	t.Helper()
+
+	var out []byte
+	p := make([]byte, size)
+	for {
+		n, err := r.Read(p)
+		out = append(out, p[:n]...)
+		if err == io.EOF {
+			return string(out)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func press(r rune) keyEvent {
+	return keyEvent{key: tcell.KeyRune, r: r, pressed: true}
+}
+
+func TestKittyKey(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		mods int
+		want keyEvent
+		ok   bool
+	}{
+		{"letter", 'a', 0, keyEvent{key: tcell.KeyRune, r: 'a'}, true},
+		{"shifted letter", 'a', 1, keyEvent{key: tcell.KeyRune, r: 'a'}, true},
+		{"ctrl-c", 'c', 4, keyEvent{key: tcell.KeyCtrlC}, true},
+		{"ctrl-shift-c", 'c', 5, keyEvent{key: tcell.KeyCtrlC}, true},
+		{"enter", 13, 0, keyEvent{key: tcell.KeyEnter}, true},
+		{"escape", 27, 0, keyEvent{key: tcell.KeyEsc}, true},
+		{"tab", 9, 0, keyEvent{key: tcell.KeyTab}, true},
+		{"backspace", 127, 0, keyEvent{key: tcell.KeyBackspace2}, true},
+		{"keypad 0", kittyKeypad, 0, keyEvent{key: tcell.KeyRune, r: '0'}, true},
+		{"keypad 9", kittyKeypad + 9, 0, keyEvent{key: tcell.KeyRune, r: '9'}, true},
+		{"keypad decimal", kittyKeypad + 10, 0, keyEvent{}, false},
+		{"left shift", 57441, 0, keyEvent{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := kittyKey(tt.code, tt.mods)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("got %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestKittyRead(t *testing.T) {
+	tests := []struct {
+		name     string
+		reads    []string
+		keys     []keyEvent
+		out      string
+		detected bool
+	}{
+		{"press", []string{"\x1b[97u"}, []keyEvent{press('a')}, "", false},
+		{"press event", []string{"\x1b[97;1:1u"}, []keyEvent{press('a')}, "", false},
+		{"repeat", []string{"\x1b[97;1:2u"}, []keyEvent{{key: tcell.KeyRune, r: 'a', pressed: true, repeat: true}}, "", false},
+		{"release", []string{"\x1b[97;1:3u"}, []keyEvent{{key: tcell.KeyRune, r: 'a'}}, "", false},
+		{"ctrl-c", []string{"\x1b[99;5u"}, []keyEvent{{key: tcell.KeyCtrlC, pressed: true}}, "", false},
+		{"keypad", []string{"\x1b[57400u\x1b[57400;1:3u"}, []keyEvent{press('1'), {key: tcell.KeyRune, r: '1'}}, "", false},
+		{"modifier", []string{"\x1b[57441u"}, nil, "", false},
+		{"detect", []string{"\x1b[?15u"}, nil, "", true},
+		{"legacy", []string{"\x1b[A"}, nil, "\x1b[A", false},
+		{"functional release", []string{"\x1b[1;1:3A"}, nil, "", false},
+		{"text around", []string{"x\x1b[97uy"}, []keyEvent{press('a')}, "xy", false},
+		{"split", []string{"\x1b[9", "7;1:3u"}, []keyEvent{{key: tcell.KeyRune, r: 'a'}}, "", false},
+		{"split after csi", []string{"x\x1b[", "99;5u"}, []keyEvent{{key: tcell.KeyCtrlC, pressed: true}}, "x", false},
+		{"split legacy", []string{"\x1b[", "A"}, nil, "\x1b[A", false},
+		{"split after escape", []string{"\x1b[?15u\x1b", "[97u"}, []keyEvent{press('a')}, "", true},
+		{"escape without protocol", []string{"\x1b", "a"}, nil, "\x1ba", false},
+		{"incomplete at end", []string{"\x1b[97"}, nil, "\x1b[97", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []keyEvent
+			detected := false
+			k := newKittyTty(&fakeTty{reads: tt.reads},
+				func(ev keyEvent) { keys = append(keys, ev) },
+				func() { detected = true })
+
+			out := readAll(t, k, 64)
+			if out != tt.out {
+				t.Errorf("passed through %q, want %q", out, tt.out)
+			}
+			if len(keys) != len(tt.keys) {
+				t.Fatalf("got keys %+v, want %+v", keys, tt.keys)
+			}
+			for i := range keys {
+				if keys[i] != tt.keys[i] {
+					t.Fatalf("got keys %+v, want %+v", keys, tt.keys)
+				}
+			}
+			if detected != tt.detected {
+				t.Fatalf("detected %v, want %v", detected, tt.detected)
+			}
+		})
+	}
+}
+
+func TestKittyReadSplit(t *testing.T) {
+	in := "\x1b[?15u\x1b[97u\x1b[57400;1:3u\x1b[A"
+	want := []keyEvent{press('a'), {key: tcell.KeyRune, r: '1'}}
+
+	// from 2, as a lone escape before the protocol is detected is the escape key
+	for split := 2; split < len(in); split++ {
+		var keys []keyEvent
+		k := newKittyTty(&fakeTty{reads: []string{in[:split], in[split:]}}, func(ev keyEvent) { keys = append(keys, ev) }, func() {})
+
+		out := readAll(t, k, 64)
+		if out != "\x1b[A" || len(keys) != 2 || keys[0] != want[0] || keys[1] != want[1] {
+			t.Fatalf("split at %d: passed through %q, got keys %+v", split, out, keys)
+		}
+	}
+}
+
+func TestKittyReadSmallBuffer(t *testing.T) {
+	// sequences that don't fit in the buffer are left to tcell
+	in := "\x1b[97u\x1b[A"
+	var keys []keyEvent
+	k := newKittyTty(&fakeTty{reads: []string{in}}, func(ev keyEvent) { keys = append(keys, ev) }, func() {})
+
+	if out := readAll(t, k, 4); out != in {
+		t.Fatalf("passed through %q, want %q", out, in)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("got keys %+v from sequences longer than the buffer", keys)
+	}
+}
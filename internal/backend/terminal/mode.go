@@ -0,0 +1,124 @@
+package terminal
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Mode is how CHIP-8 pixels are drawn with terminal cells, which are about
+// twice as tall as they are wide.
+type Mode string
+
+const (
+	// ModeBlock draws a full block per pixel, stretching the image vertically.
+	ModeBlock Mode = "block"
+	// ModeHalf draws two pixels per cell with upper and lower half blocks,
+	// keeping the pixels square.
+	ModeHalf Mode = "half"
+	// ModeQuadrant draws 2x2 pixels per cell with quadrant blocks.
+	ModeQuadrant Mode = "quadrant"
+	// ModeBraille draws 2x4 pixels per cell with braille patterns, keeping
+	// the pixels square in a quarter of the space of ModeHalf.
+	ModeBraille Mode = "braille"
+)
+
+// Modes lists the supported render modes.
+var Modes = []Mode{ModeBlock, ModeHalf, ModeQuadrant, ModeBraille}
+
+// ParseMode returns the render mode with the given name.
+func ParseMode(name string) (Mode, error) {
+	for _, m := range Modes {
+		if string(m) == name {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown terminal mode: %s", name)
+}
+
+// quadrants are the quadrant blocks indexed by the lit pixels, top left,
+// top right, bottom left and bottom right from the lowest bit.
+var quadrants = [16]rune{' ', '▘', '▝', '▀', '▖', '▌', '▞', '▛', '▗', '▚', '▐', '▜', '▄', '▙', '▟', '█'}
+
+// brailleDots are the bits of the braille pattern dots, indexed by row and column.
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// cellSize returns the number of pixels across and down drawn by a cell.
+func (m Mode) cellSize() (int, int) {
+	switch m {
+	case ModeHalf:
+		return 1, 2
+	case ModeQuadrant:
+		return 2, 2
+	case ModeBraille:
+		return 2, 4
+	default:
+		return 1, 1
+	}
+}
+
+// cell returns the character and the style drawing the pixels of a cell,
+// indexed by column and row, with the given colours.
+func (m Mode) cell(pixels [2][4]uint8, colors [4]tcell.Color) (rune, tcell.Style) {
+	style := tcell.StyleDefault.Background(colors[0])
+
+	switch m {
+	case ModeBlock:
+		if pixels[0][0] == 0 {
+			return ' ', style
+		}
+		return '█', style.Foreground(colors[pixels[0][0]&0x3])
+
+	case ModeHalf:
+		top, bottom := pixels[0][0]&0x3, pixels[0][1]&0x3
+		switch {
+		case top == 0 && bottom == 0:
+			return ' ', style
+		case top == bottom:
+			return '█', style.Foreground(colors[top])
+		case top == 0:
+			return '▄', style.Foreground(colors[bottom])
+		default:
+			return '▀', style.Foreground(colors[top]).Background(colors[bottom])
+		}
+	}
+
+	// a cell has a single foreground colour, that of most of the lit pixels
+	cw, ch := m.cellSize()
+	var counts [4]int
+	var glyph rune
+	for x := range cw {
+		for y := range ch {
+			v := pixels[x][y] & 0x3
+			if v == 0 {
+				continue
+			}
+			counts[v]++
+			if m == ModeQuadrant {
+				glyph |= 1 << (2*y + x)
+			} else {
+				glyph |= brailleDots[y][x]
+			}
+		}
+	}
+	if glyph == 0 {
+		return ' ', style
+	}
+	fg := 1
+	for v := 2; v < len(counts); v++ {
+		if counts[v] > counts[fg] {
+			fg = v
+		}
+	}
+	style = style.Foreground(colors[fg])
+
+	if m == ModeQuadrant {
+		return quadrants[glyph], style
+	}
+	return 0x2800 + glyph, style
+}
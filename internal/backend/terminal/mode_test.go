@@ -0,0 +1,93 @@
+package terminal
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestModeCell(t *testing.T) {
+	colors := [4]tcell.Color{tcell.ColorBlack, tcell.ColorWhite, tcell.ColorRed, tcell.ColorBlue}
+	bg := tcell.StyleDefault.Background(tcell.ColorBlack)
+	fg := func(c tcell.Color) tcell.Style { return bg.Foreground(c) }
+
+	// lit returns the pixels of a cell with the given ones set to v,
+	// as column and row pairs
+	lit := func(v uint8, xy ...int) [2][4]uint8 {
+		var p [2][4]uint8
+		for i := 0; i < len(xy); i += 2 {
+			p[xy[i]][xy[i+1]] = v
+		}
+		return p
+	}
+	all := func(v uint8) [2][4]uint8 { return lit(v, 0, 0, 0, 1, 0, 2, 0, 3, 1, 0, 1, 1, 1, 2, 1, 3) }
+
+	tests := []struct {
+		name   string
+		mode   Mode
+		pixels [2][4]uint8
+		glyph  rune
+		style  tcell.Style
+	}{
+		{"block off", ModeBlock, lit(0), ' ', bg},
+		{"block on", ModeBlock, lit(1, 0, 0), '█', fg(tcell.ColorWhite)},
+		{"block both planes", ModeBlock, lit(3, 0, 0), '█', fg(tcell.ColorBlue)},
+		{"block high bits", ModeBlock, lit(5, 0, 0), '█', fg(tcell.ColorWhite)},
+		{"block other pixels", ModeBlock, lit(1, 1, 0, 0, 1), ' ', bg},
+
+		{"half off", ModeHalf, lit(0), ' ', bg},
+		{"half top", ModeHalf, lit(1, 0, 0), '▀', fg(tcell.ColorWhite).Background(tcell.ColorBlack)},
+		{"half bottom", ModeHalf, lit(1, 0, 1), '▄', fg(tcell.ColorWhite)},
+		{"half both", ModeHalf, lit(2, 0, 0, 0, 1), '█', fg(tcell.ColorRed)},
+		{"half two colours", ModeHalf, [2][4]uint8{{1, 2}}, '▀', fg(tcell.ColorWhite).Background(tcell.ColorRed)},
+		{"half bottom colour", ModeHalf, [2][4]uint8{{0, 3}}, '▄', fg(tcell.ColorBlue)},
+
+		{"quadrant off", ModeQuadrant, lit(0), ' ', bg},
+		{"quadrant top left", ModeQuadrant, lit(1, 0, 0), '▘', fg(tcell.ColorWhite)},
+		{"quadrant top right", ModeQuadrant, lit(1, 1, 0), '▝', fg(tcell.ColorWhite)},
+		{"quadrant bottom left", ModeQuadrant, lit(1, 0, 1), '▖', fg(tcell.ColorWhite)},
+		{"quadrant bottom right", ModeQuadrant, lit(1, 1, 1), '▗', fg(tcell.ColorWhite)},
+		{"quadrant diagonal", ModeQuadrant, lit(1, 1, 0, 0, 1), '▞', fg(tcell.ColorWhite)},
+		{"quadrant full", ModeQuadrant, lit(2, 0, 0, 1, 0, 0, 1, 1, 1), '█', fg(tcell.ColorRed)},
+		{"quadrant outside rows", ModeQuadrant, lit(1, 0, 2, 1, 3), ' ', bg},
+		{"quadrant most lit colour", ModeQuadrant, [2][4]uint8{{2, 2}, {1, 2}}, '█', fg(tcell.ColorRed)},
+		{"quadrant colour tie", ModeQuadrant, [2][4]uint8{{3, 2}, {2, 3}}, '█', fg(tcell.ColorRed)},
+		{"quadrant first plane tie", ModeQuadrant, [2][4]uint8{{1, 3}}, '▌', fg(tcell.ColorWhite)},
+
+		{"braille off", ModeBraille, lit(0), ' ', bg},
+		{"braille top left", ModeBraille, lit(1, 0, 0), '⠁', fg(tcell.ColorWhite)},
+		{"braille top right", ModeBraille, lit(1, 1, 0), '⠈', fg(tcell.ColorWhite)},
+		{"braille bottom left", ModeBraille, lit(1, 0, 3), '⡀', fg(tcell.ColorWhite)},
+		{"braille bottom right", ModeBraille, lit(1, 1, 3), '⢀', fg(tcell.ColorWhite)},
+		{"braille left column", ModeBraille, lit(1, 0, 0, 0, 1, 0, 2, 0, 3), '⡇', fg(tcell.ColorWhite)},
+		{"braille full", ModeBraille, all(3), '⣿', fg(tcell.ColorBlue)},
+		{"braille most lit colour", ModeBraille, [2][4]uint8{{1, 2, 2}, {0, 0, 2}}, '⠧', fg(tcell.ColorRed)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			glyph, style := tt.mode.cell(tt.pixels, colors)
+			if glyph != tt.glyph || style != tt.style {
+				fgot, bgot, _ := style.Decompose()
+				fwant, bwant, _ := tt.style.Decompose()
+				t.Fatalf("got %q fg %v bg %v, want %q fg %v bg %v", glyph, fgot, bgot, tt.glyph, fwant, bwant)
+			}
+		})
+	}
+}
+
+func TestModeCellSize(t *testing.T) {
+	tests := []struct {
+		mode Mode
+		w, h int
+	}{
+		{ModeBlock, 1, 1},
+		{ModeHalf, 1, 2},
+		{ModeQuadrant, 2, 2},
+		{ModeBraille, 2, 4},
+	}
+	for _, tt := range tests {
+		if w, h := tt.mode.cellSize(); w != tt.w || h != tt.h {
+			t.Errorf("%s: got %dx%d, want %dx%d", tt.mode, w, h, tt.w, tt.h)
+		}
+	}
+}
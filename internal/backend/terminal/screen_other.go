@@ -0,0 +1,10 @@
+//go:build !unix
+
+package terminal
+
+import "github.com/gdamore/tcell/v2"
+
+// newScreen returns the default screen, key releases are always simulated.
+func (t *terminal) newScreen(kb Keyboard) (tcell.Screen, error) {
+	return tcell.NewScreen()
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package terminal
+
+import "github.com/gdamore/tcell/v2"
+
+// newScreen returns a screen telling key releases through the Linux console
+// or the kitty keyboard protocol when available.
+func (t *terminal) newScreen(kb Keyboard) (tcell.Screen, error) {
+	if kb == KeyboardTimeout {
+		return tcell.NewScreen()
+	}
+
+	tty, err := tcell.NewDevTty()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := newConsoleTty(tty, t.queueKey); ok {
+		t.releases.Store(true)
+		return tcell.NewTerminfoScreenFromTty(c)
+	}
+	return tcell.NewTerminfoScreenFromTty(newKittyTty(tty, t.queueKey, func() {
+		t.releases.Store(true)
+	}))
+}
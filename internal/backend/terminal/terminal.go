@@ -2,28 +2,90 @@ package terminal
 
 import (
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	_ "github.com/gdamore/tcell/v2/encoding"
 	"github.com/ruggi/c8/internal/display"
 	"github.com/ruggi/c8/internal/input"
+	"github.com/ruggi/c8/internal/sound"
 )
 
-const simulatedKeyUpMillis = 250 // simulating key up since the terminal doesn't know about those
+const simulatedKeyUpMillis = 250 // simulating key up when the terminal doesn't know about those
+
+var hotkeys = map[tcell.Key]input.Command{
+	tcell.KeyF5: input.SaveState,
+	tcell.KeyF6: input.PrevSlot,
+	tcell.KeyF7: input.NextSlot,
+	tcell.KeyF9: input.LoadState,
+
+	tcell.KeyF4:  input.ToggleBreakpoint,
+	tcell.KeyF8:  input.TogglePause,
+	tcell.KeyF10: input.StepOver,
+	tcell.KeyF11: input.Step,
+
+	tcell.KeyEsc:   input.Quit,
+	tcell.KeyCtrlC: input.Quit,
+}
+
+// Options configure the terminal backend.
+type Options struct {
+	// Mode is how pixels are drawn, ModeHalf by default.
+	Mode Mode
+	// Keyboard is how key releases are told, KeyboardAuto by default.
+	Keyboard Keyboard
+	// Keymap maps the typed characters to CHIP-8 keys, input.HexKeymap by default.
+	Keymap input.Keymap
+	// Palette is the colours of the pixels, display.Classic by default.
+	Palette display.Palette
+}
 
 type terminal struct {
-	mu     sync.RWMutex
-	keys   [16]int64
-	s      tcell.Screen
-	stopCh chan struct{}
-	keyCh  chan *tcell.EventKey
+	mode     Mode
+	colors   [4]tcell.Color // of the pixels, indexed by the planes they're lit on
+	keymap   input.Keymap
+	mu       sync.RWMutex
+	keys     [16]int64 // last time each key was pressed
+	held     [16]bool
+	commands []input.Command
+	rewind   int64 // last time the rewind key was seen
+	rewindOn bool
+	// releases is set when the terminal reports key releases
+	releases atomic.Bool
+	panel    []string
+	status   string
+	s        tcell.Screen
+	stopCh   chan struct{}
+	keyCh    chan keyEvent
 }
 
-func New(title string) (*terminal, error) {
-	s, err := tcell.NewScreen()
+func New(title string, opts Options) (*terminal, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeHalf
+	}
+	if opts.Keyboard == "" {
+		opts.Keyboard = KeyboardAuto
+	}
+	if opts.Keymap.Keys == nil {
+		opts.Keymap = input.HexKeymap.Keymap()
+	}
+	if opts.Palette == (display.Palette{}) {
+		opts.Palette = display.Classic.Palette()
+	}
+
+	t := &terminal{
+		mode:   opts.Mode,
+		keymap: opts.Keymap,
+		stopCh: make(chan struct{}),
+		keyCh:  make(chan keyEvent),
+	}
+	for i, c := range opts.Palette {
+		t.colors[i] = tcell.NewRGBColor(int32(c.R), int32(c.G), int32(c.B))
+	}
+
+	s, err := t.newScreen(opts.Keyboard)
 	if err != nil {
 		return nil, fmt.Errorf("new screen: %w", err)
 	}
@@ -38,18 +100,17 @@ func New(title string) (*terminal, error) {
 		Background(tcell.ColorDefault))
 	s.Clear()
 
-	stopCh := make(chan struct{})
-	keyCh := make(chan *tcell.EventKey)
+	t.s = s
 	go func() {
 		for {
 			select {
-			case <-stopCh:
+			case <-t.stopCh:
 				return
 			default:
 				ev := s.PollEvent()
 				switch ev := ev.(type) {
 				case *tcell.EventKey:
-					keyCh <- ev
+					t.queueKey(keyEvent{key: ev.Key(), r: ev.Rune(), pressed: true})
 				}
 			}
 		}
@@ -57,11 +118,15 @@ func New(title string) (*terminal, error) {
 
 	s.SetTitle(title)
 
-	return &terminal{
-		s:      s,
-		stopCh: stopCh,
-		keyCh:  keyCh,
-	}, nil
+	return t, nil
+}
+
+// queueKey passes a key event to Update, unless the terminal is closed.
+func (t *terminal) queueKey(ev keyEvent) {
+	select {
+	case t.keyCh <- ev:
+	case <-t.stopCh:
+	}
 }
 
 func (t *terminal) Name() string {
@@ -73,54 +138,96 @@ func (t *terminal) Update() {
 	case ev := <-t.keyCh:
 		t.handleKeyEvent(ev)
 	default:
-		t.handleKeyEvent(nil)
 	}
 }
 
 func (t *terminal) Render(fb display.Framebuffer) error {
 	t.s.Clear()
 
+	// the size of the screen in cells
+	cw, ch := t.mode.cellSize()
+	w := (fb.Width() + cw - 1) / cw
+	h := (fb.Height() + ch - 1) / ch
+
 	// draw a rectangle around the screen
 	// tl
 	t.s.SetCell(0, 0, tcell.StyleDefault, '┌')
 	// tr
-	t.s.SetCell(display.Width+1, 0, tcell.StyleDefault, '┐')
-	for x := 1; x <= display.Width; x++ {
+	t.s.SetCell(w+1, 0, tcell.StyleDefault, '┐')
+	for x := 1; x <= w; x++ {
 		// top
 		t.s.SetCell(x, 0, tcell.StyleDefault, '─')
 		// bottom
-		t.s.SetCell(x, display.Height+1, tcell.StyleDefault, '─')
+		t.s.SetCell(x, h+1, tcell.StyleDefault, '─')
 	}
 	// bl
-	t.s.SetCell(0, display.Height+1, tcell.StyleDefault, '└')
+	t.s.SetCell(0, h+1, tcell.StyleDefault, '└')
 	// br
-	t.s.SetCell(display.Width+1, display.Height+1, tcell.StyleDefault, '┘')
-	for y := 1; y <= display.Height; y++ {
+	t.s.SetCell(w+1, h+1, tcell.StyleDefault, '┘')
+	for y := 1; y <= h; y++ {
 		// left
 		t.s.SetCell(0, y, tcell.StyleDefault, '│')
 		// right
-		t.s.SetCell(display.Width+1, y, tcell.StyleDefault, '│')
+		t.s.SetCell(w+1, y, tcell.StyleDefault, '│')
 	}
 
-	for x := range display.Width {
-		for y := range display.Height {
-			if fb[x][y] {
-				t.s.SetCell(x+1, y+1, tcell.StyleDefault, '█')
+	for x := range w {
+		for y := range h {
+			var pixels [2][4]uint8
+			for i := range cw {
+				for j := range ch {
+					if px, py := x*cw+i, y*ch+j; px < fb.Width() && py < fb.Height() {
+						pixels[i][j] = fb.Pixels[px][py]
+					}
+				}
 			}
+			r, style := t.mode.cell(pixels, t.colors)
+			t.s.SetCell(x+1, y+1, style, r)
 		}
 	}
 
 	// print a message at the bottom of the screen
-	t.s.SetCell(0, display.Height+2, tcell.StyleDefault, []rune("(ESC) to exit")...)
+	t.s.SetCell(0, h+2, tcell.StyleDefault, []rune("(ESC) to exit")...)
+
+	t.mu.RLock()
+	for i, r := range []rune(t.status) {
+		t.s.SetContent(15+i, h+2, r, nil, tcell.StyleDefault)
+	}
+	for i, line := range t.panel {
+		for j, r := range []rune(line) {
+			t.s.SetContent(w+3+j, i, r, nil, tcell.StyleDefault)
+		}
+	}
+	t.mu.RUnlock()
 
 	t.s.Show()
 	return nil
 }
 
+// RenderPanel sets the lines to show on the right of the screen.
+func (t *terminal) RenderPanel(lines []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.panel = lines
+}
+
+// RenderStatus sets the message to show below the screen.
+func (t *terminal) RenderStatus(msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status = msg
+}
+
 func (t *terminal) GetKeys() input.KeysMap {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
+	if t.releases.Load() {
+		return t.held
+	}
+
 	now := time.Now().UnixMilli()
 
 	keys := input.KeysMap{}
@@ -130,63 +237,50 @@ func (t *terminal) GetKeys() input.KeysMap {
 	return keys
 }
 
+func (t *terminal) Commands() []input.Command {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	commands := t.commands
+	// without releases, the rewind key is held as long as the terminal keeps repeating it
+	rewinding := t.rewindOn
+	if !t.releases.Load() {
+		rewinding = time.Now().UnixMilli()-t.rewind < simulatedKeyUpMillis
+	}
+	if rewinding {
+		commands = append(commands, input.Rewind)
+	}
+	t.commands = nil
+	return commands
+}
+
+// Close restores the terminal, stopping the event loop blocked on PollEvent.
 func (t *terminal) Close() {
 	close(t.stopCh)
-	close(t.keyCh)
 	t.s.Fini()
 }
 
 // handleKeyEvent processes keyboard input and maps it to CHIP-8 keys
-func (t *terminal) handleKeyEvent(ev *tcell.EventKey) {
+func (t *terminal) handleKeyEvent(ev keyEvent) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Reset all keys
-	if ev == nil {
-		return
+	now := time.Now().UnixMilli()
+	if key, ok := t.keymap.Key(ev.r); ok && ev.key == tcell.KeyRune {
+		t.held[key] = ev.pressed
+		if ev.pressed {
+			t.keys[key] = now
+		}
 	}
 
-	now := time.Now().UnixMilli()
-	switch ev.Rune() {
-	case '1':
-		t.keys[0x1] = now
-	case '2':
-		t.keys[0x2] = now
-	case '3':
-		t.keys[0x3] = now
-	case '4':
-		t.keys[0x4] = now
-	case '5':
-		t.keys[0x5] = now
-	case '6':
-		t.keys[0x6] = now
-	case '7':
-		t.keys[0x7] = now
-	case '8':
-		t.keys[0x8] = now
-	case '9':
-		t.keys[0x9] = now
-	case '0':
-		t.keys[0x0] = now
-	case 'a':
-		t.keys[0xA] = now
-	case 'b':
-		t.keys[0xB] = now
-	case 'c':
-		t.keys[0xC] = now
-	case 'd':
-		t.keys[0xD] = now
-	case 'e':
-		t.keys[0xE] = now
-	case 'f':
-		t.keys[0xF] = now
-	}
-
-	// Handle special keys
-	switch ev.Key() {
-	case tcell.KeyEsc:
-		t.s.Fini()
-		os.Exit(0)
+	if cmd, ok := hotkeys[ev.key]; ok && ev.pressed && !ev.repeat {
+		t.commands = append(t.commands, cmd)
+	}
+	if ev.key == tcell.KeyBackspace || ev.key == tcell.KeyBackspace2 {
+		t.rewindOn = ev.pressed
+		if ev.pressed {
+			t.rewind = now
+		}
 	}
 }
 
@@ -194,3 +288,8 @@ func (t *terminal) Buzz() error {
 	fmt.Print("\a")
 	return nil
 }
+
+// SetPattern is a no-op, the terminal bell can't play audio patterns.
+func (t *terminal) SetPattern(p sound.Pattern) error {
+	return nil
+}
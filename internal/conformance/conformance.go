@@ -0,0 +1,244 @@
+// Package conformance runs test ROMs headlessly and compares the final
+// display against golden hashes.
+package conformance
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ruggi/c8/internal/backend/headless"
+	"github.com/ruggi/c8/internal/display"
+	"github.com/ruggi/c8/internal/emulator"
+)
+
+//go:embed manifest.json
+var defaultManifest []byte
+
+//go:embed golden.json
+var defaultGolden []byte
+
+// Test describes how to run a test ROM.
+type Test struct {
+	Name     string            `json:"name"`
+	ROM      string            `json:"rom"`
+	Platform emulator.Platform `json:"platform"`
+	Frames   int               `json:"frames"`
+	// Poke holds the memory values to set before running, keyed by address.
+	Poke map[string]uint8 `json:"poke,omitempty"`
+	// Keys are the key presses and releases to script.
+	Keys []headless.KeyEvent `json:"keys,omitempty"`
+}
+
+type Manifest struct {
+	Tests []Test `json:"tests"`
+}
+
+// DefaultManifest returns the bundled manifest for the Timendus CHIP-8 test suite.
+func DefaultManifest() (Manifest, error) {
+	return parseManifest(defaultManifest)
+}
+
+// LoadManifest reads a manifest from a JSON file.
+func LoadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("read manifest: %w", err)
+	}
+	return parseManifest(data)
+}
+
+// Golden maps the test names to the hashes of their final display.
+type Golden map[string]string
+
+// DefaultGolden returns the bundled golden hashes of the Timendus CHIP-8 test suite.
+func DefaultGolden() (Golden, error) {
+	return parseGolden(defaultGolden)
+}
+
+// LoadGolden reads golden hashes from a JSON file.
+func LoadGolden(path string) (Golden, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read golden: %w", err)
+	}
+	return parseGolden(data)
+}
+
+func parseGolden(data []byte) (Golden, error) {
+	g := Golden{}
+	err := json.Unmarshal(data, &g)
+	if err != nil {
+		return nil, fmt.Errorf("parse golden: %w", err)
+	}
+	return g, nil
+}
+
+// Save writes the golden hashes to a JSON file.
+func (g Golden) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, append(data, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("write golden: %w", err)
+	}
+	return nil
+}
+
+func parseManifest(data []byte) (Manifest, error) {
+	var m Manifest
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("parse manifest: %w", err)
+	}
+	return m, nil
+}
+
+type Status string
+
+const (
+	Pass    Status = "PASS"
+	Fail    Status = "FAIL"
+	Missing Status = "MISSING" // no golden hash
+	Updated Status = "UPDATED"
+	Error   Status = "ERROR"
+)
+
+type Result struct {
+	Test   Test
+	Status Status
+	Hash   string
+	Err    error
+}
+
+// Failed reports whether the result should count as a failure.
+func (r Result) Failed() bool {
+	return r.Status != Pass && r.Status != Updated
+}
+
+type Runner struct {
+	// SuiteDir is the directory containing the test ROMs.
+	SuiteDir string
+	// Golden holds the hashes to compare against.
+	Golden Golden
+	// InstructionsPerFrame is the number of instructions executed each frame.
+	InstructionsPerFrame int
+	// Update records the hashes in Golden instead of comparing against them.
+	Update bool
+}
+
+// Run runs every test of the manifest.
+func (r Runner) Run(m Manifest) []Result {
+	results := make([]Result, 0, len(m.Tests))
+	for _, t := range m.Tests {
+		results = append(results, r.RunTest(t))
+	}
+	return results
+}
+
+// RunTest runs a single test and checks its final display against the golden hash.
+func (r Runner) RunTest(t Test) Result {
+	res := Result{Test: t}
+
+	hash, err := r.hash(t)
+	if err != nil {
+		res.Status, res.Err = Error, err
+		return res
+	}
+	res.Hash = hash
+
+	if r.Update {
+		r.Golden[t.Name] = hash
+		res.Status = Updated
+		return res
+	}
+
+	want, ok := r.Golden[t.Name]
+	if !ok {
+		res.Status = Missing
+		return res
+	}
+	if want != hash {
+		res.Status = Fail
+		return res
+	}
+	res.Status = Pass
+	return res
+}
+
+func (r Runner) hash(t Test) (string, error) {
+	rom, err := os.ReadFile(filepath.Join(r.SuiteDir, t.ROM))
+	if err != nil {
+		return "", fmt.Errorf("read rom: %w", err)
+	}
+
+	platform, err := emulator.ParsePlatform(string(t.Platform))
+	if err != nil {
+		return "", err
+	}
+
+	b, err := headless.New(t.Name)
+	if err != nil {
+		return "", err
+	}
+	b.Script(t.Keys)
+
+	e := emulator.New(b, emulator.Options{
+		Platform: platform,
+		Quirks:   platform.Quirks(),
+	})
+	if err := e.Load(rom); err != nil {
+		return "", err
+	}
+
+	for addr, v := range t.Poke {
+		a, err := strconv.ParseUint(addr, 0, 16)
+		if err != nil {
+			return "", fmt.Errorf("invalid poke address %q: %w", addr, err)
+		}
+		e.Poke(uint16(a), v)
+	}
+
+	err = e.RunFrames(b, t.Frames, r.InstructionsPerFrame)
+	if err != nil {
+		return "", fmt.Errorf("cpu fault: %w", err)
+	}
+
+	return Hash(b.Framebuffer()), nil
+}
+
+// Hash returns the SHA-256 of the visible part of the framebuffer.
+func Hash(fb display.Framebuffer) string {
+	h := sha256.New()
+	w, ht := fb.Width(), fb.Height()
+	h.Write([]byte{uint8(w), uint8(ht)})
+	for y := range ht {
+		for x := range w {
+			h.Write([]byte{fb.Pixels[x][y]})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WriteTable prints the results as a table.
+func WriteTable(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEST\tPLATFORM\tRESULT\tHASH")
+	for _, r := range results {
+		detail := r.Hash
+		if r.Err != nil {
+			detail = r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Test.Name, r.Test.Platform, r.Status, detail)
+	}
+	tw.Flush()
+}
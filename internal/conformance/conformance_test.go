@@ -0,0 +1,117 @@
+package conformance
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// suiteDir is where TestSuite looks for the Timendus test suite ROMs, unless
+// C8_SUITE_DIR is set.
+const suiteDir = "testdata/chip8-test-suite/bin"
+
+func TestSuite(t *testing.T) {
+	dir := os.Getenv("C8_SUITE_DIR")
+	if dir == "" {
+		dir = suiteDir
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Skipf("test suite not found in %s, set C8_SUITE_DIR to run it", dir)
+	}
+
+	m, err := DefaultManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := DefaultGolden()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Runner{SuiteDir: dir, Golden: golden, InstructionsPerFrame: 1000}
+	for _, test := range m.Tests {
+		t.Run(test.Name, func(t *testing.T) {
+			res := r.RunTest(test)
+			if res.Failed() {
+				t.Errorf("%s: hash %s, err %v", res.Status, res.Hash, res.Err)
+			}
+		})
+	}
+}
+
+// TestBundledGolden checks that every test of the bundled manifest has a
+// bundled golden hash, without which the runner can't catch regressions.
+func TestBundledGolden(t *testing.T) {
+	m, err := DefaultManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := DefaultGolden()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(golden) == 0 {
+		t.Fatal("no bundled golden hashes, record them with c8 test -g internal/conformance/golden.json -u")
+	}
+	for _, test := range m.Tests {
+		if _, ok := golden[test.Name]; !ok {
+			t.Errorf("no bundled golden hash for %s", test.Name)
+		}
+	}
+}
+
+func TestRunner(t *testing.T) {
+	dir := t.TempDir()
+	// draws the 0 font sprite, then loops
+	rom := []byte{0x60, 0x00, 0xF0, 0x29, 0xD0, 0x05, 0x12, 0x06}
+	err := os.WriteFile(filepath.Join(dir, "zero.ch8"), rom, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := Test{Name: "zero", ROM: "zero.ch8", Platform: "vip", Frames: 10}
+
+	golden := Golden{}
+	r := Runner{SuiteDir: dir, Golden: golden, InstructionsPerFrame: 100}
+
+	if res := r.RunTest(test); res.Status != Missing || !res.Failed() {
+		t.Fatalf("without a golden hash: got %s", res.Status)
+	}
+
+	r.Update = true
+	res := r.RunTest(test)
+	if res.Status != Updated || res.Failed() || golden["zero"] != res.Hash {
+		t.Fatalf("update: got %s, golden %q, hash %q", res.Status, golden["zero"], res.Hash)
+	}
+
+	r.Update = false
+	if res := r.RunTest(test); res.Status != Pass {
+		t.Fatalf("with the recorded hash: got %s", res.Status)
+	}
+
+	golden["zero"] = "0000"
+	if res := r.RunTest(test); res.Status != Fail {
+		t.Fatalf("with a different hash: got %s", res.Status)
+	}
+
+	test.ROM = "missing.ch8"
+	if res := r.RunTest(test); res.Status != Error || res.Err == nil {
+		t.Fatalf("without the ROM: got %s", res.Status)
+	}
+}
+
+func TestGoldenSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.json")
+	want := Golden{"a": "0123", "b": "4567"}
+	err := want.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadGolden(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || got["a"] != want["a"] || got["b"] != want["b"] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
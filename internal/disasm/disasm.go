@@ -0,0 +1,212 @@
+// Package disasm turns ROMs into labelled assembly listings.
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ruggi/c8/internal/assembler"
+	"github.com/ruggi/c8/internal/emulator"
+)
+
+const bytesPerDataLine = 8
+
+type Options struct {
+	Syntax   emulator.Syntax
+	Platform emulator.Platform
+	// Origin is the address the ROM is loaded at, where execution starts.
+	Origin uint16
+}
+
+type listing struct {
+	opts   Options
+	rom    []byte
+	mem    []byte
+	code   map[uint16]emulator.Instruction
+	labels map[uint16]string
+	// inside holds the targets inside an instruction, which can't be labelled
+	inside map[uint16]bool
+}
+
+// Disassemble writes the listing of rom to w. Code is told apart from data by
+// following the execution from the origin: anything that isn't reachable is
+// listed as data. Octo listings are only written for ROMs at the origin the
+// assembler builds programs for.
+func Disassemble(w io.Writer, rom []byte, opts Options) error {
+	if opts.Syntax == emulator.Octo && opts.Origin != assembler.Origin {
+		return fmt.Errorf("octo listings are assembled for %#x, not %#x", assembler.Origin, opts.Origin)
+	}
+	if int(opts.Origin)+len(rom) > 0x10000 {
+		return fmt.Errorf("rom too large: %d bytes", len(rom))
+	}
+
+	l := &listing{
+		opts:   opts,
+		rom:    rom,
+		mem:    make([]byte, 0x10000),
+		code:   map[uint16]emulator.Instruction{},
+		labels: map[uint16]string{},
+		inside: map[uint16]bool{},
+	}
+	copy(l.mem[opts.Origin:], rom)
+
+	l.trace()
+	l.label()
+
+	return l.write(w)
+}
+
+func (l *listing) inROM(addr uint16) bool {
+	return addr >= l.opts.Origin && int(addr) < int(l.opts.Origin)+len(l.rom)
+}
+
+// trace finds the reachable instructions.
+func (l *listing) trace() {
+	queue := []uint16{l.opts.Origin}
+	for len(queue) > 0 {
+		addr := queue[0]
+		queue = queue[1:]
+
+		if _, ok := l.code[addr]; ok || !l.inROM(addr) {
+			continue
+		}
+
+		ins := emulator.Decode(l.mem, addr, l.opts.Platform)
+		l.code[addr] = ins
+
+		next := addr + ins.Size()
+		switch ins.Flow {
+		case emulator.FlowNext:
+			queue = append(queue, next)
+		case emulator.FlowSkip:
+			skipped := emulator.Decode(l.mem, next, l.opts.Platform)
+			queue = append(queue, next, next+skipped.Size())
+		case emulator.FlowJump:
+			queue = append(queue, ins.Target)
+		case emulator.FlowCall:
+			queue = append(queue, ins.Target, next)
+		}
+	}
+}
+
+// label names the targets of the reachable instructions, except the ones
+// inside another instruction, which are left as addresses.
+func (l *listing) label() {
+	kinds := map[uint16]string{}
+	rank := map[string]int{"data": 0, "label": 1, "sub": 2}
+
+	interior := map[uint16]bool{}
+	for _, ins := range l.code {
+		for a := ins.Addr + 1; a < ins.Addr+ins.Size(); a++ {
+			interior[a] = true
+		}
+	}
+
+	for _, ins := range l.code {
+		if !ins.HasTarget || !l.inROM(ins.Target) {
+			continue
+		}
+		if interior[ins.Target] {
+			l.inside[ins.Target] = true
+			continue
+		}
+		kind := "data"
+		switch ins.Flow {
+		case emulator.FlowJump, emulator.FlowIndirect:
+			kind = "label"
+		case emulator.FlowCall:
+			kind = "sub"
+		}
+		if prev, ok := kinds[ins.Target]; !ok || rank[kind] > rank[prev] {
+			kinds[ins.Target] = kind
+		}
+	}
+
+	for addr, kind := range kinds {
+		l.labels[addr] = fmt.Sprintf("%s_%03X", kind, addr)
+	}
+	l.labels[l.opts.Origin] = "main"
+}
+
+func (l *listing) write(w io.Writer) error {
+	var b strings.Builder
+
+	comment := ";"
+	if l.opts.Syntax == emulator.Octo {
+		comment = "#"
+	}
+	fmt.Fprintf(&b, "%s disassembled by c8\n", comment)
+
+	end := int(l.opts.Origin) + len(l.rom)
+	for p := int(l.opts.Origin); p < end; {
+		addr := uint16(p)
+		if name, ok := l.labels[addr]; ok {
+			l.writeLabel(&b, name)
+		}
+
+		ins, ok := l.code[addr]
+		if ok && p+int(ins.Size()) <= end {
+			l.writeInstruction(&b, ins)
+			for a := addr + 1; a < addr+ins.Size(); a++ {
+				if l.inside[a] {
+					fmt.Fprintf(&b, "\t%s %04X, inside the instruction above, is a target\n", comment, a)
+				}
+			}
+			p += int(ins.Size())
+			continue
+		}
+
+		// data runs until the next instruction or label
+		n := 1
+		for n < bytesPerDataLine && p+n < end {
+			next := uint16(p + n)
+			if _, ok := l.code[next]; ok {
+				break
+			}
+			if _, ok := l.labels[next]; ok {
+				break
+			}
+			n++
+		}
+		l.writeData(&b, addr, l.rom[p-int(l.opts.Origin):p-int(l.opts.Origin)+n])
+		p += n
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (l *listing) writeLabel(b *strings.Builder, name string) {
+	if l.opts.Syntax == emulator.Octo {
+		fmt.Fprintf(b, ": %s\n", name)
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", name)
+}
+
+func (l *listing) writeInstruction(b *strings.Builder, ins emulator.Instruction) {
+	text := ins.Format(l.opts.Syntax, func(addr uint16) string {
+		return l.labels[addr]
+	})
+	raw := fmt.Sprintf("%X", ins.Bytes)
+
+	if l.opts.Syntax == emulator.Octo {
+		fmt.Fprintf(b, "\t%-32s # %04X  %s\n", text, ins.Addr, raw)
+		return
+	}
+	fmt.Fprintf(b, "  %04X  %-8s  %s\n", ins.Addr, raw, text)
+}
+
+func (l *listing) writeData(b *strings.Builder, addr uint16, data []byte) {
+	var values []string
+	for _, v := range data {
+		values = append(values, fmt.Sprintf("0x%02X", v))
+	}
+
+	if l.opts.Syntax == emulator.Octo {
+		fmt.Fprintf(b, "\t%-32s # %04X\n", strings.Join(values, " "), addr)
+		return
+	}
+	fmt.Fprintf(b, "  %04X  %-8s  DB %s\n", addr, "", strings.Join(values, ", "))
+}
@@ -0,0 +1,142 @@
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ruggi/c8/internal/assembler"
+	"github.com/ruggi/c8/internal/emulator"
+)
+
+func disassemble(t *testing.T, rom []byte, syntax emulator.Syntax, platform emulator.Platform) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := Disassemble(&buf, rom, Options{Syntax: syntax, Platform: platform, Origin: assembler.Origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// TestOctoRoundTrip checks that Octo listings of random ROMs assemble back
+// to the same bytes.
+func TestOctoRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, platform := range []emulator.Platform{emulator.VIP, emulator.XOCHIP} {
+		for i := range 1000 {
+			rom := make([]byte, 2+rnd.Intn(256))
+			rnd.Read(rom)
+
+			listing := disassemble(t, rom, emulator.Octo, platform)
+			prog, err := assembler.Assemble(listing)
+			if err != nil {
+				t.Fatalf("%s rom %d %X: %s\n%s", platform, i, rom, err, listing)
+			}
+			if !bytes.Equal(prog.ROM, rom) {
+				t.Fatalf("%s rom %d %X: assembled to %X\n%s", platform, i, rom, prog.ROM, listing)
+			}
+		}
+	}
+}
+
+// TestProgramsRoundTrip checks that listings of the programs in testdata,
+// written in Octo syntax for either platform, assemble back to the same ROM.
+func TestProgramsRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.8o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := assembler.Assemble(string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, platform := range []emulator.Platform{emulator.VIP, emulator.XOCHIP} {
+				listing := disassemble(t, want.ROM, emulator.Octo, platform)
+				got, err := assembler.Assemble(listing)
+				if err != nil {
+					t.Fatalf("%s: %s\n%s", platform, err, listing)
+				}
+				if !bytes.Equal(got.ROM, want.ROM) {
+					t.Fatalf("%s: assembled to %X, want %X\n%s", platform, got.ROM, want.ROM, listing)
+				}
+			}
+		})
+	}
+}
+
+func TestNonCanonical(t *testing.T) {
+	tests := []struct {
+		rom     []byte
+		classic string
+		octo    string
+	}{
+		{[]byte{0x99, 0xE0}, "SNE V9, VE", "if v9 == ve then"},
+		{[]byte{0x99, 0xEB}, "DW 0x99EB", "0x99 0xEB"},
+		{[]byte{0x51, 0x21}, "DW 0x5121", "0x51 0x21"},
+		{[]byte{0x81, 0x28}, "DW 0x8128", "0x81 0x28"},
+		{[]byte{0xE1, 0x00}, "DW 0xE100", "0xE1 0x00"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%X", tt.rom), func(t *testing.T) {
+			classic := disassemble(t, tt.rom, emulator.Classic, emulator.VIP)
+			if !strings.Contains(classic, tt.classic) {
+				t.Errorf("classic listing doesn't have %q:\n%s", tt.classic, classic)
+			}
+			octo := disassemble(t, tt.rom, emulator.Octo, emulator.VIP)
+			if !strings.Contains(octo, tt.octo) {
+				t.Errorf("octo listing doesn't have %q:\n%s", tt.octo, octo)
+			}
+		})
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	rom := []byte{0x00, 0xE0, 0x16, 0x00}
+
+	var buf bytes.Buffer
+	err := Disassemble(&buf, rom, Options{Syntax: emulator.Classic, Platform: emulator.ETI660, Origin: 0x600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "main:\n  0600  00E0") || !strings.Contains(buf.String(), "JP main") {
+		t.Fatalf("listing doesn't start at 0x600:\n%s", buf.String())
+	}
+
+	// the assembler can't place the program back at 0x600
+	err = Disassemble(&buf, rom, Options{Syntax: emulator.Octo, Platform: emulator.ETI660, Origin: 0x600})
+	if err == nil {
+		t.Fatal("octo listing at 0x600 not rejected")
+	}
+}
+
+func TestTargetInsideInstruction(t *testing.T) {
+	// the jump at 0x202 is reached by the skip and jumps into its own middle
+	rom := []byte{0x30, 0x00, 0x12, 0x03, 0x00, 0xE0}
+
+	listing := disassemble(t, rom, emulator.Octo, emulator.VIP)
+	if !strings.Contains(listing, "jump 0x203") || !strings.Contains(listing, "0203, inside the instruction above, is a target") {
+		t.Fatalf("target not left as an address:\n%s", listing)
+	}
+	prog, err := assembler.Assemble(listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(prog.ROM, rom) {
+		t.Fatalf("assembled to %X", prog.ROM)
+	}
+}
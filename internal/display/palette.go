@@ -0,0 +1,152 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Color is an RGB colour.
+type Color struct {
+	R, G, B uint8
+}
+
+// ParseColor parses a colour written as RRGGBB hex digits, optionally
+// prefixed by #.
+func ParseColor(s string) (Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(hex, 16, 24)
+	if err != nil || len(hex) != 6 {
+		return Color{}, fmt.Errorf("invalid colour %q, expected #RRGGBB", s)
+	}
+	return Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+}
+
+func (c Color) String() string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// mix returns the colour t of the way from c to d.
+func (c Color) mix(d Color, t float64) Color {
+	lerp := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t + 0.5)
+	}
+	return Color{R: lerp(c.R, d.R), G: lerp(c.G, d.G), B: lerp(c.B, d.B)}
+}
+
+// Palette holds the colours of the pixels, indexed like the Framebuffer
+// pixels by the planes they're lit on: the background, the first plane, the
+// second plane and both planes. Only the first two are used outside of
+// XO-CHIP.
+type Palette [4]Color
+
+// Theme is a named palette.
+type Theme string
+
+const (
+	// Classic is white on black.
+	Classic Theme = "classic"
+	// Amber is an amber monochrome monitor.
+	Amber Theme = "amber"
+	// Green is a green phosphor monochrome monitor.
+	Green Theme = "green"
+	// LCD is a dot matrix handheld LCD.
+	LCD Theme = "lcd"
+	// Octo is the default palette of the Octo IDE.
+	Octo Theme = "octo"
+)
+
+// Themes lists the supported themes.
+var Themes = []Theme{Classic, Amber, Green, LCD, Octo}
+
+// ParseTheme returns the theme with the given name.
+func ParseTheme(name string) (Theme, error) {
+	for _, t := range Themes {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown theme: %s", name)
+}
+
+// Palette returns the palette of the theme.
+func (t Theme) Palette() Palette {
+	switch t {
+	case Amber:
+		return monochrome(Color{0x00, 0x00, 0x00}, Color{0xFF, 0xB0, 0x00})
+	case Green:
+		return monochrome(Color{0x00, 0x00, 0x00}, Color{0x33, 0xFF, 0x33})
+	case LCD:
+		return Palette{{0x9B, 0xBC, 0x0F}, {0x0F, 0x38, 0x0F}, {0x30, 0x62, 0x30}, {0x8B, 0xAC, 0x0F}}
+	case Octo:
+		return Palette{{0x99, 0x66, 0x00}, {0xFF, 0xCC, 0x00}, {0xFF, 0x66, 0x00}, {0x66, 0x22, 0x00}}
+	default:
+		return monochrome(Color{0x00, 0x00, 0x00}, Color{0xFF, 0xFF, 0xFF})
+	}
+}
+
+// monochrome returns a palette drawing the first plane in fg on bg, with the
+// second plane and both planes fading towards bg.
+func monochrome(bg, fg Color) Palette {
+	return Palette{bg, fg, bg.mix(fg, 2.0/3), bg.mix(fg, 1.0/3)}
+}
+
+// ParsePalette parses a theme name, or comma separated colours: two for the
+// background and the pixels, or four as in Palette.
+func ParsePalette(s string) (Palette, error) {
+	if t, err := ParseTheme(s); err == nil {
+		return t.Palette(), nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 4 {
+		return Palette{}, fmt.Errorf("invalid palette %q, expected a theme or 2 or 4 colours", s)
+	}
+	var colors []Color
+	for _, p := range parts {
+		c, err := ParseColor(strings.TrimSpace(p))
+		if err != nil {
+			return Palette{}, err
+		}
+		colors = append(colors, c)
+	}
+	if len(colors) == 2 {
+		return monochrome(colors[0], colors[1]), nil
+	}
+	return Palette(colors), nil
+}
+
+// paletteFile is a palette as written in a JSON file, either a theme or
+// colours as accepted by ParsePalette, e.g.
+//
+//	{"colors": ["#000000", "#FFFFFF", "#AAAAAA", "#555555"]}
+type paletteFile struct {
+	Theme  Theme    `json:"theme"`
+	Colors []string `json:"colors"`
+}
+
+// LoadPalette reads a palette from a JSON file.
+func LoadPalette(path string) (Palette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Palette{}, fmt.Errorf("read palette: %w", err)
+	}
+
+	var f paletteFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return Palette{}, fmt.Errorf("parse palette %s: %w", path, err)
+	}
+
+	s := string(f.Theme)
+	if len(f.Colors) > 0 {
+		s = strings.Join(f.Colors, ",")
+	}
+	p, err := ParsePalette(s)
+	if err != nil {
+		return Palette{}, fmt.Errorf("parse palette %s: %w", path, err)
+	}
+	return p, nil
+}
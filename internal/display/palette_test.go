@@ -0,0 +1,133 @@
+package display
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// gray is the classic palette, white on black with the other planes in grays.
+var gray = Palette{{0x00, 0x00, 0x00}, {0xFF, 0xFF, 0xFF}, {0xAA, 0xAA, 0xAA}, {0x55, 0x55, 0x55}}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Color
+		wantErr bool
+	}{
+		{"#FF8000", Color{0xFF, 0x80, 0x00}, false},
+		{"FF8000", Color{0xFF, 0x80, 0x00}, false},
+		{"#0a0b0c", Color{0x0A, 0x0B, 0x0C}, false},
+		{"#000000", Color{}, false},
+		{"", Color{}, true},
+		{"#", Color{}, true},
+		{"#FFF", Color{}, true},
+		{"#FF80", Color{}, true},
+		{"#FF800000", Color{}, true},
+		{"#0FF8000", Color{}, true},
+		{"##FF8000", Color{}, true},
+		{"#GG8000", Color{}, true},
+		{"+F8000", Color{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseColor(tt.s)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("got %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if s := (Color{0x0A, 0xB0, 0xFF}).String(); s != "#0AB0FF" {
+		t.Fatalf("got %s, want #0AB0FF", s)
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	four := Palette{{0x11, 0x11, 0x11}, {0x22, 0x22, 0x22}, {0x33, 0x33, 0x33}, {0x44, 0x44, 0x44}}
+
+	tests := []struct {
+		name    string
+		s       string
+		want    Palette
+		wantErr bool
+	}{
+		{"classic", "classic", gray, false},
+		{"amber", "amber", Amber.Palette(), false},
+		{"octo", "octo", Octo.Palette(), false},
+		{"two colours", "#000000,#FFFFFF", gray, false},
+		{"two colours without #", "000000,ffffff", gray, false},
+		{"spaces", " #000000 , #FFFFFF ", gray, false},
+		{"two colours faded", "#000000,#FF0000", Palette{{0, 0, 0}, {0xFF, 0, 0}, {0xAA, 0, 0}, {0x55, 0, 0}}, false},
+		{"four colours", "#111111,#222222,#333333,#444444", four, false},
+		{"one colour", "#FFFFFF", Palette{}, true},
+		{"three colours", "#000000,#FFFFFF,#AAAAAA", Palette{}, true},
+		{"five colours", "#111111,#222222,#333333,#444444,#555555", Palette{}, true},
+		{"bad colour", "#000000,#FFFFF", Palette{}, true},
+		{"unknown theme", "sepia", Palette{}, true},
+		{"empty", "", Palette{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePalette(tt.s)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("got %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestThemes(t *testing.T) {
+	for _, theme := range Themes {
+		t.Run(string(theme), func(t *testing.T) {
+			got, err := ParseTheme(string(theme))
+			if err != nil || got != theme {
+				t.Fatalf("got %v, %v", got, err)
+			}
+			p := theme.Palette()
+			if p[0] == p[1] {
+				t.Fatalf("pixels drawn in the background colour %v", p[0])
+			}
+		})
+	}
+	if p := Theme("sepia").Palette(); p != gray {
+		t.Fatalf("unknown theme palette %v, want the classic one", p)
+	}
+}
+
+func TestLoadPalette(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		json    string
+		want    Palette
+		wantErr bool
+	}{
+		{"theme", `{"theme": "lcd"}`, LCD.Palette(), false},
+		{"two colours", `{"colors": ["#000000", "#FFFFFF"]}`, gray, false},
+		{"four colours", `{"colors": ["#000000", "#FFFFFF", "#AAAAAA", "#555555"]}`, gray, false},
+		{"colours over theme", `{"theme": "lcd", "colors": ["000000", "FFFFFF"]}`, gray, false},
+		{"three colours", `{"colors": ["#000000", "#FFFFFF", "#AAAAAA"]}`, Palette{}, true},
+		{"bad colour", `{"colors": ["#000000", "white"]}`, Palette{}, true},
+		{"unknown theme", `{"theme": "sepia"}`, Palette{}, true},
+		{"empty", `{}`, Palette{}, true},
+		{"invalid json", `{"theme": `, Palette{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadPalette(path)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("got %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := LoadPalette(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("no error for a missing file")
+	}
+}
@@ -3,11 +3,53 @@ package display
 const (
 	Width  = 64 // px
 	Height = 32 // px
+
+	HiResWidth  = 128 // px
+	HiResHeight = 64  // px
 )
 
-type Framebuffer [Width][Height]bool
+// Planes is the number of XO-CHIP bitplanes.
+const Planes = 2
+
+// Framebuffer holds the screen pixels. In low resolution mode only the
+// top-left Width x Height area is used.
+//
+// Each pixel is a bitmask of the planes it's lit on, so a value in [0, 4)
+// that backends map to one of four colours.
+type Framebuffer struct {
+	HiRes  bool
+	Pixels [HiResWidth][HiResHeight]uint8
+}
+
+// Width returns the width of the current resolution.
+func (fb Framebuffer) Width() int {
+	if fb.HiRes {
+		return HiResWidth
+	}
+	return Width
+}
+
+// Height returns the height of the current resolution.
+func (fb Framebuffer) Height() int {
+	if fb.HiRes {
+		return HiResHeight
+	}
+	return Height
+}
 
 type Manager interface {
 	Render(fb Framebuffer) error
 	Close()
 }
+
+// PanelRenderer is implemented by the backends able to show a text panel
+// next to the screen, e.g. for the debugger.
+type PanelRenderer interface {
+	RenderPanel(lines []string)
+}
+
+// StatusRenderer is implemented by the backends able to show a short status
+// message, e.g. the outcome of saving a state.
+type StatusRenderer interface {
+	RenderStatus(msg string)
+}
@@ -0,0 +1,209 @@
+package emulator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// debugger pauses the CPU on breakpoints and steps through instructions.
+type debugger struct {
+	paused      bool
+	breakpoints map[uint16]bool
+
+	// step runs a single instruction while paused
+	step bool
+	// skipBreak lets the instruction at a breakpoint run when resuming from it
+	skipBreak bool
+
+	// stepping over a call runs until the return address at the same stack depth
+	over   bool
+	overPC uint16
+	overSP uint8
+
+	// stopped is set when the CPU stops, until the panel is shown
+	stopped bool
+
+	// fault is the CPU fault the debugger was paused on
+	fault error
+	// watch describes the watchpoint the debugger was paused on
+	watch string
+}
+
+func newDebugger(breakpoints []uint16, paused bool) *debugger {
+	d := &debugger{
+		breakpoints: map[uint16]bool{},
+		paused:      paused,
+		stopped:     paused,
+	}
+	for _, addr := range breakpoints {
+		d.breakpoints[addr] = true
+	}
+	return d
+}
+
+// shouldRun reports whether the instruction at pc can be executed.
+func (d *debugger) shouldRun(c *Emulator) bool {
+	if d.over && c.pc == d.overPC && c.sp == d.overSP {
+		d.over = false
+		d.pause()
+		return false
+	}
+
+	if d.paused {
+		if !d.step {
+			return false
+		}
+		d.step = false
+		d.stopped = true
+		return true
+	}
+
+	if !d.skipBreak {
+		wp, watched := c.execWatchpoint(c.pc)
+		if watched {
+			d.breakOnWatch(wp, fmt.Sprintf("exec %04X", c.pc))
+			return false
+		}
+		if d.breakpoints[c.pc] {
+			d.over = false
+			d.pause()
+			return false
+		}
+	}
+	d.skipBreak = false
+
+	return true
+}
+
+func (d *debugger) pause() {
+	d.paused = true
+	d.stopped = true
+}
+
+// breakOnWatch pauses on a breaking watchpoint, described with the access
+// triggering it. Only the first of the watchpoints an instruction triggers
+// is shown.
+func (d *debugger) breakOnWatch(wp Watchpoint, access string) {
+	if d.watch == "" {
+		d.watch = fmt.Sprintf("%s: %s", wp, access)
+	}
+	d.over = false
+	d.pause()
+}
+
+func (d *debugger) togglePause() {
+	if d.paused {
+		d.paused = false
+		d.fault = nil
+		d.watch = ""
+		d.skipBreak = true
+		return
+	}
+	d.pause()
+}
+
+func (d *debugger) stepInto() {
+	if d.paused {
+		d.step = true
+		d.fault = nil
+		d.watch = ""
+	}
+}
+
+// stepOver steps over 2NNN calls, running until they return.
+func (d *debugger) stepOver(c *Emulator) {
+	if !d.paused {
+		return
+	}
+	if _, ok := parseInstruction(c.opcodeAt(c.pc)).(op2NNN); !ok {
+		d.stepInto()
+		return
+	}
+	d.over = true
+	d.overPC = c.pc + 2
+	d.overSP = c.sp
+	d.paused = false
+	d.skipBreak = true
+	d.fault = nil
+	d.watch = ""
+}
+
+func (d *debugger) toggleBreakpoint(addr uint16) {
+	if d.breakpoints[addr] {
+		delete(d.breakpoints, addr)
+	} else {
+		d.breakpoints[addr] = true
+	}
+}
+
+// panel returns the lines describing the state of the CPU.
+func (d *debugger) panel(c *Emulator) []string {
+	state := "RUNNING"
+	if d.paused {
+		state = "PAUSED"
+	}
+
+	lines := []string{
+		fmt.Sprintf("PC %04X  I %04X  %s", c.pc, c.index, state),
+		fmt.Sprintf("DT %02X    ST %02X", c.delayTimer, c.soundTimer),
+		"",
+	}
+	if d.fault != nil {
+		lines = append(lines, "FAULT "+d.fault.Error(), "")
+	}
+	if d.watch != "" {
+		lines = append(lines, "WATCH "+d.watch, "")
+	}
+	for i := 0; i < len(c.registers); i += 4 {
+		var regs []string
+		for r := i; r < i+4; r++ {
+			regs = append(regs, fmt.Sprintf("V%X %02X", r, c.registers[r]))
+		}
+		lines = append(lines, strings.Join(regs, "  "))
+	}
+
+	var stack []string
+	for i := range c.sp {
+		if c.source != nil {
+			stack = append(stack, c.source.symbol(c.stack[i]))
+			continue
+		}
+		stack = append(stack, fmt.Sprintf("%04X", c.stack[i]))
+	}
+	lines = append(lines, "", fmt.Sprintf("SP %d  [%s]", c.sp, strings.Join(stack, " ")), "")
+
+	if c.source != nil {
+		lines = append(lines, "at "+c.source.symbol(c.pc))
+		lines = append(lines, c.source.listing(c.pc, d.breakpoints, 12)...)
+	} else {
+		lines = append(lines, d.disassembly(c)...)
+	}
+
+	lines = append(lines, "",
+		"(F8) pause/resume",
+		"(F10) step over  (F11) step",
+		"(F4) breakpoint at PC",
+	)
+
+	return lines
+}
+
+// disassembly returns the instructions around pc.
+func (d *debugger) disassembly(c *Emulator) []string {
+	var lines []string
+	addr := c.pc - 4
+	for range 12 {
+		ins := Decode(c.memory[:], addr, c.platform)
+
+		marker := "  "
+		if addr == c.pc {
+			marker = "> "
+		}
+		if d.breakpoints[addr] {
+			marker = marker[:1] + "*"
+		}
+		lines = append(lines, fmt.Sprintf("%s%04X  %s", marker, addr, ins.Format(Classic, nil)))
+		addr += ins.Size()
+	}
+	return lines
+}
@@ -0,0 +1,85 @@
+package emulator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ruggi/c8/internal/backend/headless"
+	"github.com/ruggi/c8/internal/input"
+)
+
+func TestDebuggerStopsTimers(t *testing.T) {
+	b, _ := headless.New("test")
+	c := New(b, Options{Debug: true, RewindSeconds: 1})
+	if err := c.Load([]byte{0x12, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	c.delayTimer, c.soundTimer = 10, 10
+
+	run := func(cmd input.Command) {
+		t.Helper()
+		if cmd != 0 {
+			b.Command(cmd)
+		}
+		if err := c.RunFrames(b, 3, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(0)
+	run(input.Step)
+	if c.delayTimer != 10 || c.soundTimer != 10 || b.Buzzes() != 0 || c.rewind.size != 0 {
+		t.Fatalf("paused debugger: DT %d, ST %d, %d buzzes, %d rewind frames", c.delayTimer, c.soundTimer, b.Buzzes(), c.rewind.size)
+	}
+
+	run(input.TogglePause)
+	if c.delayTimer != 7 || c.soundTimer != 7 || b.Buzzes() != 3 || c.rewind.size != 2 {
+		t.Fatalf("resumed debugger: DT %d, ST %d, %d buzzes, %d rewind frames", c.delayTimer, c.soundTimer, b.Buzzes(), c.rewind.size)
+	}
+}
+
+func TestWatchpointPanel(t *testing.T) {
+	tests := []struct {
+		name  string
+		watch string
+		want  string
+	}{
+		{"write", "0x302-0x30F:w", "WATCH 0x302-0x30F:w: write 0302 = 2A at 0204"},
+		{"read", "0x301:r", "WATCH 0x301:r: read 0301 = 00 at 0208"},
+		{"exec", "0x206:rwx", "WATCH 0x206:rwx: exec 0206"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wp, err := ParseWatchpoint(tt.watch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := headless.New("test")
+			c := New(b, Options{Watchpoints: []Watchpoint{wp}, OnFault: FaultDebug})
+			// writes 00 00 2A to 0x300, then reads 0x300-0x301
+			rom := []byte{0x62, 0x2A, 0xA3, 0x00, 0xF2, 0x55, 0xA3, 0x00, 0xF1, 0x65, 0x12, 0x0A}
+			if err := c.Load(rom); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.RunFrames(b, 1, 10); err != nil {
+				t.Fatal(err)
+			}
+
+			if !c.debugger.paused {
+				t.Fatal("watchpoint didn't break")
+			}
+			panel := strings.Join(c.debugger.panel(c), "\n")
+			if !strings.Contains(panel, tt.want) {
+				t.Fatalf("panel doesn't show %q:\n%s", tt.want, panel)
+			}
+
+			b.Command(input.TogglePause)
+			if err := c.RunFrames(b, 1, 1); err != nil {
+				t.Fatal(err)
+			}
+			if c.debugger.watch != "" {
+				t.Fatalf("watch %q not cleared on resume", c.debugger.watch)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package emulator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Syntax is the assembly syntax instructions are formatted with.
+type Syntax string
+
+const (
+	Classic Syntax = "classic"
+	Octo    Syntax = "octo"
+)
+
+// Flow describes where the execution continues after an instruction.
+type Flow int
+
+const (
+	FlowNext     Flow = iota // the next instruction
+	FlowSkip                 // the next instruction, or the one after it
+	FlowJump                 // Target
+	FlowCall                 // Target, then the next instruction once it returns
+	FlowReturn               // the caller
+	FlowExit                 // nowhere, the interpreter stops
+	FlowIndirect             // an address only known at runtime (BNNN)
+)
+
+// Instruction is an instruction decoded from memory.
+type Instruction struct {
+	Addr  uint16
+	Bytes []byte
+	Flow  Flow
+	// Target is the address the instruction jumps to, calls or loads into I.
+	Target    uint16
+	HasTarget bool
+
+	ins instruction
+	// raw is set when the bytes aren't the canonical encoding of ins, which
+	// its syntax can't write, so they're formatted as data instead
+	raw bool
+}
+
+// Size returns the size of the instruction in bytes.
+func (i Instruction) Size() uint16 {
+	return uint16(len(i.Bytes))
+}
+
+// Decode decodes the instruction at addr. Memory past the end of mem reads
+// as zero. The XO-CHIP instructions, like F000 NNNN, are unknown on the
+// other platforms.
+func Decode(mem []byte, addr uint16, platform Platform) Instruction {
+	at := func(a uint16) byte {
+		if int(a) < len(mem) {
+			return mem[a]
+		}
+		return 0
+	}
+
+	opcode := uint16(at(addr))<<8 | uint16(at(addr+1))
+	i := Instruction{
+		Addr:  addr,
+		Bytes: []byte{at(addr), at(addr + 1)},
+		ins:   parseInstruction(opcode),
+	}
+
+	switch i.ins.(type) {
+	case opF000, op00DN, op5XY2, op5XY3, opFN01, opF002, opFX3A:
+		if platform != XOCHIP {
+			i.ins = opUnknown{opcode: opcode}
+		}
+	}
+
+	switch o := i.ins.(type) {
+	case opF000:
+		i.Bytes = append(i.Bytes, at(addr+2), at(addr+3))
+		i.Target, i.HasTarget = uint16(i.Bytes[2])<<8|uint16(i.Bytes[3]), true
+	case op00EE:
+		i.Flow = FlowReturn
+	case op00FD:
+		i.Flow = FlowExit
+	case op1NNN:
+		i.Flow, i.Target, i.HasTarget = FlowJump, o.in.nnn, true
+	case op2NNN:
+		i.Flow, i.Target, i.HasTarget = FlowCall, o.in.nnn, true
+	case opANNN:
+		i.Target, i.HasTarget = o.in.nnn, true
+	case opBNNN:
+		i.Flow, i.Target, i.HasTarget = FlowIndirect, o.in.nnn, true
+	case op9XY0:
+		// runs whatever the low nibble, but it's only written as 0
+		i.Flow, i.raw = FlowSkip, o.in.n != 0
+	case op3XNNN, op4XNN, op5XY0, opEX9E, opEXA1:
+		i.Flow = FlowSkip
+	}
+
+	return i
+}
+
+// Format returns the instruction in the given syntax. When label is not nil
+// it's used to name the target addresses, falling back to hex when it
+// returns an empty string.
+func (i Instruction) Format(syntax Syntax, label func(addr uint16) string) string {
+	target := fmt.Sprintf("0x%03X", i.Target)
+	if _, ok := i.ins.(opF000); ok {
+		target = fmt.Sprintf("0x%04X", i.Target)
+	}
+	if label != nil && i.HasTarget {
+		if l := label(i.Target); l != "" {
+			target = l
+		}
+	}
+
+	if i.raw {
+		return i.data(syntax)
+	}
+	if syntax == Octo {
+		return i.octo(target)
+	}
+
+	switch i.ins.(type) {
+	case op1NNN:
+		return "JP " + target
+	case op2NNN:
+		return "CALL " + target
+	case opANNN:
+		return "LD I, " + target
+	case opBNNN:
+		return "JP V0, " + target
+	case opF000:
+		if i.HasTarget {
+			return "LD I, LONG " + target
+		}
+	}
+	return i.ins.String()
+}
+
+func (i Instruction) octo(target string) string {
+	v := func(r uint8) string {
+		return fmt.Sprintf("v%x", r)
+	}
+
+	switch o := i.ins.(type) {
+	case op00E0:
+		return "clear"
+	case op00EE:
+		return "return"
+	case op00CN:
+		return fmt.Sprintf("scroll-down %d", o.in.n)
+	case op00DN:
+		return fmt.Sprintf("scroll-up %d", o.in.n)
+	case op00FB:
+		return "scroll-right"
+	case op00FC:
+		return "scroll-left"
+	case op00FD:
+		return "exit"
+	case op00FE:
+		return "lores"
+	case op00FF:
+		return "hires"
+	case op1NNN:
+		return "jump " + target
+	case op2NNN:
+		if strings.HasPrefix(target, "0x") {
+			return ":call " + target
+		}
+		return target
+	case op3XNNN:
+		return fmt.Sprintf("if %s != 0x%02X then", v(o.in.x), o.in.nn)
+	case op4XNN:
+		return fmt.Sprintf("if %s == 0x%02X then", v(o.in.x), o.in.nn)
+	case op5XY0:
+		return fmt.Sprintf("if %s != %s then", v(o.in.x), v(o.in.y))
+	case op5XY2:
+		return fmt.Sprintf("save %s - %s", v(o.in.x), v(o.in.y))
+	case op5XY3:
+		return fmt.Sprintf("load %s - %s", v(o.in.x), v(o.in.y))
+	case op6XNN:
+		return fmt.Sprintf("%s := 0x%02X", v(o.in.x), o.in.nn)
+	case op7XNN:
+		return fmt.Sprintf("%s += 0x%02X", v(o.in.x), o.in.nn)
+	case op8XY0:
+		return fmt.Sprintf("%s := %s", v(o.in.x), v(o.in.y))
+	case op8XY1:
+		return fmt.Sprintf("%s |= %s", v(o.in.x), v(o.in.y))
+	case op8XY2:
+		return fmt.Sprintf("%s &= %s", v(o.in.x), v(o.in.y))
+	case op8XY3:
+		return fmt.Sprintf("%s ^= %s", v(o.in.x), v(o.in.y))
+	case op8XY4:
+		return fmt.Sprintf("%s += %s", v(o.in.x), v(o.in.y))
+	case op8XY5:
+		return fmt.Sprintf("%s -= %s", v(o.in.x), v(o.in.y))
+	case op8XY6:
+		return fmt.Sprintf("%s >>= %s", v(o.in.x), v(o.in.y))
+	case op8XY7:
+		return fmt.Sprintf("%s =- %s", v(o.in.x), v(o.in.y))
+	case op8XYE:
+		return fmt.Sprintf("%s <<= %s", v(o.in.x), v(o.in.y))
+	case op9XY0:
+		return fmt.Sprintf("if %s == %s then", v(o.in.x), v(o.in.y))
+	case opANNN:
+		return "i := " + target
+	case opBNNN:
+		return "jump0 " + target
+	case opCXNN:
+		return fmt.Sprintf("%s := random 0x%02X", v(o.in.x), o.in.nn)
+	case opDXYN:
+		return fmt.Sprintf("sprite %s %s %d", v(o.in.x), v(o.in.y), o.in.n)
+	case opEX9E:
+		return fmt.Sprintf("if %s -key then", v(o.in.x))
+	case opEXA1:
+		return fmt.Sprintf("if %s key then", v(o.in.x))
+	case opF000:
+		if i.HasTarget {
+			return "i := long " + target
+		}
+	case opFN01:
+		return fmt.Sprintf("plane %d", o.in.x)
+	case opF002:
+		return "audio"
+	case opFX07:
+		return fmt.Sprintf("%s := delay", v(o.in.x))
+	case opFX0A:
+		return fmt.Sprintf("%s := key", v(o.in.x))
+	case opFX15:
+		return fmt.Sprintf("delay := %s", v(o.in.x))
+	case opFX18:
+		return fmt.Sprintf("buzzer := %s", v(o.in.x))
+	case opFX1E:
+		return fmt.Sprintf("i += %s", v(o.in.x))
+	case opFX29:
+		return fmt.Sprintf("i := hex %s", v(o.in.x))
+	case opFX30:
+		return fmt.Sprintf("i := bighex %s", v(o.in.x))
+	case opFX33:
+		return fmt.Sprintf("bcd %s", v(o.in.x))
+	case opFX3A:
+		return fmt.Sprintf("pitch := %s", v(o.in.x))
+	case opFX55:
+		return fmt.Sprintf("save %s", v(o.in.x))
+	case opFX65:
+		return fmt.Sprintf("load %s", v(o.in.x))
+	case opFX75:
+		return fmt.Sprintf("saveflags %s", v(o.in.x))
+	case opFX85:
+		return fmt.Sprintf("loadflags %s", v(o.in.x))
+	}
+
+	// no Octo statement for it
+	return i.data(Octo)
+}
+
+// data returns the bytes of the instruction as data.
+func (i Instruction) data(syntax Syntax) string {
+	if syntax == Octo {
+		var bytes []string
+		for _, b := range i.Bytes {
+			bytes = append(bytes, fmt.Sprintf("0x%02X", b))
+		}
+		return strings.Join(bytes, " ")
+	}
+	return fmt.Sprintf("DW 0x%X", i.Bytes)
+}
@@ -0,0 +1,255 @@
+package emulator
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ruggi/c8/internal/input"
+)
+
+// keypad is an input.Manager with fixed keys.
+type keypad input.KeysMap
+
+func (k *keypad) GetKeys() input.KeysMap    { return input.KeysMap(*k) }
+func (k *keypad) Commands() []input.Command { return nil }
+
+// differ steps the emulator and the reference side by side.
+type differ struct {
+	t   *testing.T
+	c   *Emulator
+	ref *reference
+}
+
+func newDiffer(t *testing.T, platform Platform, rom []byte, keys input.KeysMap) *differ {
+	t.Helper()
+
+	k := keypad(keys)
+	// the programs are written for 0x200, whatever the platform default
+	c := New(&k, Options{Platform: platform, Quirks: platform.Quirks(), LoadAddress: 0x200})
+	if err := c.Load(rom); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := newReference(platform, rom)
+	ref.keys = keys
+
+	return &differ{t: t, c: c, ref: ref}
+}
+
+// run executes up to steps instructions, failing on the first divergence. It
+// stops early at an instruction the reference doesn't model, returning the
+// number of instructions executed.
+func (d *differ) run(steps int) int {
+	d.t.Helper()
+
+	for step := range steps {
+		if !d.ref.modelled() {
+			return step
+		}
+
+		pc := d.c.pc
+		opcode := d.c.opcodeAt(pc)
+
+		err := d.c.tick()
+		if err != nil {
+			d.t.Fatalf("step %d, %04X %04X: %s", step, pc, opcode, err)
+		}
+		d.ref.step()
+
+		if diff := d.compare(); diff != "" {
+			d.t.Fatalf("step %d, %04X %04X (%s): %s", step, pc, opcode, parseInstruction(opcode), diff)
+		}
+	}
+	return steps
+}
+
+// compare returns the first difference between the emulator and the reference.
+func (d *differ) compare() string {
+	c, ref := d.c, d.ref
+
+	for i := range c.registers {
+		if c.registers[i] != ref.v[i] {
+			return fmt.Sprintf("V%X = %02X, want %02X", i, c.registers[i], ref.v[i])
+		}
+	}
+	if c.index != ref.i {
+		return fmt.Sprintf("I = %04X, want %04X", c.index, ref.i)
+	}
+	if c.pc != ref.pc {
+		return fmt.Sprintf("PC = %04X, want %04X", c.pc, ref.pc)
+	}
+	if int(c.sp) != len(ref.stack) {
+		return fmt.Sprintf("SP = %d, want %d", c.sp, len(ref.stack))
+	}
+	for i, addr := range ref.stack {
+		if c.stack[i] != addr {
+			return fmt.Sprintf("stack[%d] = %04X, want %04X", i, c.stack[i], addr)
+		}
+	}
+	if c.delayTimer != ref.dt || c.soundTimer != ref.st {
+		return fmt.Sprintf("DT, ST = %02X, %02X, want %02X, %02X", c.delayTimer, c.soundTimer, ref.dt, ref.st)
+	}
+	if c.memory != ref.mem {
+		for addr := range c.memory {
+			if c.memory[addr] != ref.mem[addr] {
+				return fmt.Sprintf("memory[%04X] = %02X, want %02X", addr, c.memory[addr], ref.mem[addr])
+			}
+		}
+	}
+	for x := range ref.screen {
+		for y := range ref.screen[x] {
+			if (c.fb.Pixels[x][y] != 0) != ref.screen[x][y] {
+				return fmt.Sprintf("pixel %d,%d = %t, want %t", x, y, c.fb.Pixels[x][y] != 0, ref.screen[x][y])
+			}
+		}
+	}
+	return ""
+}
+
+// randomProgram returns size bytes of CHIP-8 instructions, ending with jumps
+// back to the start so that the execution stays within the program. Calls,
+// returns, BNNN, key and random instructions are left to the curated tests,
+// since random ones would overflow the stack, leave the program or depend on
+// state the reference doesn't model.
+func randomProgram(rnd *rand.Rand, size int) []byte {
+	rom := make([]byte, size)
+	for i := 0; i < size-4; i += 2 {
+		op := randomInstruction(rnd, size-4)
+		rom[i], rom[i+1] = byte(op>>8), byte(op)
+	}
+	copy(rom[size-4:], []byte{0x12, 0x00, 0x12, 0x00})
+	return rom
+}
+
+func randomInstruction(rnd *rand.Rand, size int) uint16 {
+	x := uint16(rnd.Intn(16)) << 8
+	y := uint16(rnd.Intn(16)) << 4
+	nn := uint16(rnd.Intn(256))
+	target := uint16(0x200 + 2*rnd.Intn(size/2))
+
+	switch rnd.Intn(13) {
+	case 0:
+		return 0x00E0
+	case 1:
+		return 0x1000 | target
+	case 2:
+		return 0x3000 | x | nn
+	case 3:
+		return 0x4000 | x | nn
+	case 4:
+		return 0x5000 | x | y
+	case 5:
+		return 0x6000 | x | nn
+	case 6:
+		return 0x7000 | x | nn
+	case 7, 8:
+		ops := []uint16{0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0xE}
+		return 0x8000 | x | y | ops[rnd.Intn(len(ops))]
+	case 9:
+		return 0x9000 | x | y
+	case 10:
+		return 0xA000 | uint16(rnd.Intn(0x1000))
+	case 11:
+		return 0xD000 | x | y | uint16(1+rnd.Intn(15))
+	}
+	ops := []uint16{0x07, 0x15, 0x18, 0x1E, 0x29, 0x33, 0x55, 0x65}
+	return 0xF000 | x | ops[rnd.Intn(len(ops))]
+}
+
+func TestDifferentialRandom(t *testing.T) {
+	const (
+		programs = 200
+		size     = 128
+		steps    = 500
+	)
+
+	for _, platform := range Platforms {
+		t.Run(string(platform), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			for p := range programs {
+				rom := randomProgram(rnd, size)
+				t.Run(fmt.Sprint(p), func(t *testing.T) {
+					newDiffer(t, platform, rom, input.KeysMap{}).run(steps)
+				})
+			}
+		})
+	}
+}
+
+func TestDifferentialCurated(t *testing.T) {
+	tests := []struct {
+		name  string
+		rom   []byte
+		steps int
+		keys  input.KeysMap
+	}{
+		{
+			name:  "8XY4 carry wins over the result in VF",
+			rom:   []byte{0x6F, 0xF0, 0x61, 0x20, 0x8F, 0x14},
+			steps: 3,
+		},
+		{
+			name:  "8XY5 borrow with operands over 0x7F",
+			rom:   []byte{0x60, 0x90, 0x61, 0x10, 0x80, 0x15, 0x62, 0x10, 0x63, 0x90, 0x82, 0x35},
+			steps: 6,
+		},
+		{
+			name:  "8XY5 with equal operands",
+			rom:   []byte{0x60, 0x42, 0x61, 0x42, 0x80, 0x15},
+			steps: 3,
+		},
+		{
+			name:  "8XY5 and 8XY7 into VF",
+			rom:   []byte{0x6F, 0x05, 0x61, 0x10, 0x8F, 0x15, 0x6F, 0x05, 0x8F, 0x17},
+			steps: 5,
+		},
+		{
+			name:  "8XY7 flag from the operands",
+			rom:   []byte{0x60, 0x10, 0x61, 0xF0, 0x80, 0x17, 0x62, 0xF0, 0x63, 0x10, 0x82, 0x37, 0x84, 0x47},
+			steps: 7,
+		},
+		{
+			name:  "shifts into VF",
+			rom:   []byte{0x6F, 0x81, 0x8F, 0xF6, 0x6F, 0x81, 0x8F, 0xFE},
+			steps: 4,
+		},
+		{
+			name:  "call and return",
+			rom:   []byte{0x22, 0x06, 0x60, 0x01, 0x12, 0x04, 0x22, 0x0A, 0x00, 0xEE, 0x61, 0x02, 0x00, 0xEE},
+			steps: 8,
+		},
+		{
+			name:  "BCD, save and load",
+			rom:   []byte{0x60, 0xFE, 0xA3, 0x00, 0xF0, 0x33, 0xF2, 0x65, 0xA3, 0x10, 0xF2, 0x55, 0xF2, 0x65},
+			steps: 7,
+		},
+		{
+			name:  "sprites wrap or clip at the edges and collide",
+			rom:   []byte{0x60, 0x3C, 0x61, 0x1E, 0xF2, 0x29, 0xD0, 0x15, 0xD0, 0x15, 0x60, 0x7F, 0x61, 0x3F, 0xD0, 0x15},
+			steps: 8,
+		},
+		{
+			name:  "keys",
+			rom:   []byte{0x60, 0x05, 0xE0, 0x9E, 0x61, 0x01, 0xE0, 0xA1, 0x62, 0x01, 0x60, 0x06, 0xE0, 0x9E, 0x63, 0x01, 0xE0, 0xA1, 0x64, 0x01},
+			steps: 8,
+			keys:  input.KeysMap{5: true},
+		},
+		{
+			name:  "jump with offset",
+			rom:   []byte{0x60, 0x04, 0x62, 0x02, 0xB2, 0x02, 0x00, 0xE0, 0x00, 0xE0, 0x00, 0xE0},
+			steps: 4,
+		},
+	}
+
+	for _, platform := range Platforms {
+		for _, tt := range tests {
+			t.Run(string(platform)+"/"+tt.name, func(t *testing.T) {
+				n := newDiffer(t, platform, tt.rom, tt.keys).run(tt.steps)
+				if n != tt.steps {
+					t.Fatalf("stopped after %d of %d steps, at an instruction the reference doesn't model", n, tt.steps)
+				}
+			})
+		}
+	}
+}
@@ -1,18 +1,117 @@
 package emulator
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ruggi/c8/internal/backend"
 	"github.com/ruggi/c8/internal/display"
 	"github.com/ruggi/c8/internal/input"
+	"github.com/ruggi/c8/internal/sound"
 )
 
-const romStart = 0x200
+type Options struct {
+	Platform Platform
+	Quirks   Quirks
+	// LoadAddress is where the ROM is loaded and execution starts, the
+	// platform default when 0.
+	LoadAddress uint16
+	// StatePath is the path save state slots are written to, suffixed by the slot number.
+	StatePath string
+	// RewindSeconds is how far back in time rewinding can go, 0 disables it.
+	RewindSeconds int
+	// Debug enables the debugger, which starts paused unless there are
+	// Breakpoints or breaking Watchpoints to wait for.
+	Debug       bool
+	Breakpoints []uint16
+	// Source shows the source lines in the debugger instead of the disassembly.
+	Source *Source
+	// Watchpoints break into the debugger, or log to WatchLog, on memory accesses.
+	Watchpoints []Watchpoint
+	WatchLog    io.Writer
+	// Trace, when set, gets a record of every executed instruction.
+	Trace       io.Writer
+	TraceFormat TraceFormat
+	// OnFault is what to do when the CPU faults, FaultHalt by default.
+	OnFault FaultPolicy
+}
+
+// Errors returned by Load for ROMs that can't be run.
+var (
+	ErrEmptyROM           = errors.New("empty rom")
+	ErrROMTooLarge        = errors.New("rom too large")
+	ErrInvalidLoadAddress = errors.New("invalid load address")
+)
+
+// minLoadAddress is the first address after the interpreter area, holding the
+// fonts.
+const minLoadAddress = 0x200
+
+const (
+	minStateSlot = 1
+	maxStateSlot = 9
+)
+
+const (
+	timerRate = 60 // Hz
+
+	fontStart    = 0x000
+	bigFontStart = 0x050
+)
+
+var font = [16 * 5]uint8{
+	0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+	0x20, 0x60, 0x20, 0x20, 0x70, // 1
+	0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+	0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+	0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+	0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+	0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+	0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+	0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+	0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+	0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+	0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+	0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+	0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+	0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+}
+
+// bigFont is the SUPER-CHIP 8x10 font, extended with A-F as in XO-CHIP.
+var bigFont = [16 * 10]uint8{
+	0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+	0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+	0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+	0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+	0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+	0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+	0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+	0x3C, 0x7E, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, // A
+	0xFC, 0xFE, 0xC3, 0xC3, 0xFE, 0xFE, 0xC3, 0xC3, 0xFE, 0xFC, // B
+	0x3C, 0x7E, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0x7E, 0x3C, // C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
 
 type Emulator struct {
-	memory [4096]uint8
-	pc     uint16
+	platform Platform
+	quirks   Quirks
+
+	// sized for XO-CHIP, other platforms only use the first 4K
+	memory      [0x10000]uint8
+	pc          uint16
+	loadAddress uint16
 
 	stack [16]uint16
 	sp    uint8
@@ -29,82 +128,475 @@ type Emulator struct {
 
 	waitingForKey bool
 	keyWaitTarget uint8
+	// set by DXYN with the display wait quirk, until the next frame
+	waitingForVBlank bool
+
+	// SUPER-CHIP persistent flag registers (FX75/FX85)
+	rplFlags [16]uint8
+
+	// set by 00FD, stops the CPU
+	halted bool
+	// set by Pause, stops the CPU and the timers
+	paused atomic.Bool
+	// set by the quit command and 00FD, stops Run
+	quit bool
+	// the fault of the instruction being executed, if any
+	fault   error
+	onFault FaultPolicy
+
+	// XO-CHIP bitplanes selected by FN01
+	planes uint8
+
+	// XO-CHIP audio
+	pattern      sound.Pattern
+	patternDirty bool
+
+	statePath string
+	stateSlot int
+
+	// status is the message shown to the user for statusTimer more frames
+	status      string
+	statusTimer int
+	statusDirty bool
+
+	rewind    *rewindBuffer
+	rewinding bool
+
+	debugger *debugger
+	source   *Source
+
+	watchpoints []Watchpoint
+	watchLog    io.Writer
+	// address of the instruction being executed
+	opPC uint16
+
+	tracer *tracer
 }
 
-func New(input input.Manager) *Emulator {
+func New(input input.Manager, opts Options) *Emulator {
+	if opts.Platform == "" {
+		opts.Platform = VIP
+	}
+	if opts.OnFault == "" {
+		opts.OnFault = FaultHalt
+	}
+	if opts.LoadAddress == 0 {
+		opts.LoadAddress = opts.Platform.LoadAddress()
+	}
+
 	c := &Emulator{
-		input: input,
-	}
-
-	c.memory = [4096]uint8{
-		// seed memory with the font sprites
-		0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
-		0x20, 0x60, 0x20, 0x20, 0x70, // 1
-		0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
-		0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
-		0x90, 0x90, 0xF0, 0x10, 0x10, // 4
-		0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
-		0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
-		0xF0, 0x10, 0x20, 0x40, 0x40, // 7
-		0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
-		0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
-		0xF0, 0x90, 0xF0, 0x90, 0x90, // A
-		0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
-		0xF0, 0x80, 0x80, 0x80, 0xF0, // C
-		0xE0, 0x90, 0x90, 0x90, 0xE0, // D
-		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
-		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+		platform: opts.Platform,
+		quirks:   opts.Quirks,
+		input:    input,
+		pc:       opts.LoadAddress,
+
+		loadAddress: opts.LoadAddress,
+		planes:      1,
+		pattern:     sound.Pattern{Pitch: sound.DefaultPitch},
+
+		statePath: opts.StatePath,
+		stateSlot: minStateSlot,
+		onFault:   opts.OnFault,
 	}
 
+	if opts.Debug || opts.OnFault == FaultDebug {
+		paused := opts.Debug && len(opts.Breakpoints) == 0
+		for _, wp := range opts.Watchpoints {
+			paused = paused && !wp.Break
+		}
+		c.debugger = newDebugger(opts.Breakpoints, paused)
+	}
+	c.source = opts.Source
+	c.watchpoints = opts.Watchpoints
+	c.watchLog = opts.WatchLog
+	if opts.Trace != nil {
+		c.tracer = newTracer(opts.Trace, opts.TraceFormat)
+	}
+	if opts.RewindSeconds > 0 {
+		c.rewind = newRewindBuffer(opts.RewindSeconds * timerRate)
+	}
+
+	copy(c.memory[fontStart:], font[:])
+	copy(c.memory[bigFontStart:], bigFont[:])
+
 	return c
 }
 
-func (c *Emulator) Load(rom []byte) {
-	for i := range rom {
-		c.memory[romStart+i] = rom[i]
+// Load copies the ROM into memory at the load address.
+func (c *Emulator) Load(rom []byte) error {
+	if err := CheckROM(rom, c.platform, c.loadAddress); err != nil {
+		return err
+	}
+	copy(c.memory[c.loadAddress:], rom)
+	return nil
+}
+
+// CheckROM returns the error Load would for the ROM loaded at the address on
+// the platform.
+func CheckROM(rom []byte, platform Platform, loadAddress uint16) error {
+	start, end := int(loadAddress), platform.MemorySize()
+	if start < minLoadAddress || start >= end {
+		return fmt.Errorf("%w: %#x, it must be from %#x to %#x on %s", ErrInvalidLoadAddress, start, minLoadAddress, end-1, platform)
+	}
+	if len(rom) == 0 {
+		return ErrEmptyROM
+	}
+	if size := end - start; len(rom) > size {
+		return fmt.Errorf("%w: %d bytes, at most %d fit from %#x on %s", ErrROMTooLarge, len(rom), size, start, platform)
 	}
+	return nil
+}
+
+// Clock is the speed Run executes at. The timers always count down at 60Hz,
+// independently of the render rate.
+type Clock struct {
+	// CPURate is the number of instructions executed per second.
+	CPURate int
+	// InstructionsPerFrame, when set, executes a batch of instructions every
+	// 60Hz frame instead, ignoring CPURate.
+	InstructionsPerFrame int
+	// RenderRate is the number of times per second the display is rendered.
+	RenderRate int
 }
 
-func (c *Emulator) Run(b backend.Backend, cpuRate, renderRate int) error {
-	cpuInterval := time.Second / time.Duration(cpuRate)
-	renderInterval := time.Second / time.Duration(renderRate)
+// ErrInvalidClock is returned by Run for a clock it can't run at.
+var ErrInvalidClock = errors.New("invalid clock")
+
+// Validate returns an ErrInvalidClock for rates that aren't positive and a
+// negative number of instructions per frame.
+func (clock Clock) Validate() error {
+	switch {
+	case clock.CPURate <= 0:
+		return fmt.Errorf("%w: cpu rate %d isn't positive", ErrInvalidClock, clock.CPURate)
+	case clock.RenderRate <= 0:
+		return fmt.Errorf("%w: render rate %d isn't positive", ErrInvalidClock, clock.RenderRate)
+	case clock.InstructionsPerFrame < 0:
+		return fmt.Errorf("%w: %d instructions per frame", ErrInvalidClock, clock.InstructionsPerFrame)
+	}
+	return nil
+}
+
+// ValidateFrames returns an ErrInvalidClock for a number of instructions per
+// frame RunFrames can't run with, which unlike Run's has to be positive.
+func ValidateFrames(ipf int) error {
+	if ipf <= 0 {
+		return fmt.Errorf("%w: %d instructions per frame isn't positive", ErrInvalidClock, ipf)
+	}
+	return nil
+}
+
+// Run runs the emulator in real time until the context is cancelled, the
+// backend requests to quit, the program exits with 00FD or a fault halts the
+// CPU. It returns the context error or the fault, nil when quitting or
+// exiting, and an ErrInvalidClock without running for an invalid clock.
+func (c *Emulator) Run(ctx context.Context, b backend.Backend, clock Clock) error {
+	if err := clock.Validate(); err != nil {
+		return err
+	}
+	defer c.flushTrace()
+
+	ipf := clock.InstructionsPerFrame
+	cpuInterval := time.Second / time.Duration(clock.CPURate)
+	timerInterval := time.Second / timerRate
+	renderInterval := time.Second / time.Duration(clock.RenderRate)
 
 	cpuTime := time.Now()
+	timerTime := time.Now()
 	renderTime := time.Now()
 
-	for {
+	for !c.quit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		now := time.Now()
 
 		// cpu
-		for now.Sub(cpuTime) >= cpuInterval {
-			b.Update()
-			c.tick()
+		for ipf == 0 && now.Sub(cpuTime) >= cpuInterval {
+			err := c.cycle(b)
+			if err != nil {
+				return err
+			}
 			cpuTime = cpuTime.Add(cpuInterval)
 		}
 
-		// render and timers
-		if now.Sub(renderTime) >= renderInterval {
-			c.updateTimers()
-			b.Render(c.fb)
-			if c.soundTimer > 0 {
-				b.Buzz()
+		// timers, and the cpu in instructions per frame mode
+		for now.Sub(timerTime) >= timerInterval {
+			for range ipf {
+				err := c.cycle(b)
+				if err != nil {
+					return err
+				}
 			}
+			c.updateFrame(b)
+			timerTime = timerTime.Add(timerInterval)
+		}
+
+		if now.Sub(renderTime) >= renderInterval {
+			c.render(b)
 			renderTime = renderTime.Add(renderInterval)
 		}
 
 		time.Sleep(100 * time.Microsecond)
 	}
+	return nil
 }
 
-func (c *Emulator) tick() {
-	op1 := c.memory[c.pc]
-	op2 := c.memory[c.pc+1]
-	c.pcUP()
+// RunFrames runs the emulator as fast as possible for the given number of
+// frames, executing ipf instructions per frame. It stops early on a fault
+// halting the CPU, or after the frame the program exits in or the backend
+// requests to quit. It returns an ErrInvalidClock without running unless ipf
+// is positive.
+func (c *Emulator) RunFrames(b backend.Backend, frames, ipf int) error {
+	if err := ValidateFrames(ipf); err != nil {
+		return err
+	}
+	defer c.flushTrace()
 
-	opcode := uint16(op1)<<8 | uint16(op2)
+	for range frames {
+		if c.quit {
+			return nil
+		}
+		for range ipf {
+			err := c.cycle(b)
+			if err != nil {
+				return err
+			}
+		}
+		c.updateFrame(b)
+		c.render(b)
+	}
+	return nil
+}
+
+// cycle polls the backend and executes the next instruction if the CPU can run.
+func (c *Emulator) cycle(b backend.Backend) error {
+	b.Update()
+	if !c.canRun() {
+		return nil
+	}
+	return c.step()
+}
+
+// updateFrame handles the hotkeys, updates the timers and the sound, at 60Hz.
+// While the rewind hotkey is held it steps back one frame instead.
+func (c *Emulator) updateFrame(b backend.Backend) {
+	c.rewinding = false
+	c.waitingForVBlank = false
+	for _, cmd := range b.Commands() {
+		c.command(cmd)
+	}
+
+	stopped := c.cpuStopped()
+	if c.rewinding {
+		c.rewind.rewind(c)
+	} else if !stopped {
+		c.updateTimers()
+		if c.rewind != nil {
+			c.rewind.capture(c)
+		}
+	}
+
+	if c.patternDirty {
+		b.SetPattern(c.pattern)
+		c.patternDirty = false
+	}
+	if c.soundTimer > 0 && !c.rewinding && !stopped {
+		b.Buzz()
+	}
+
+	if c.statusTimer > 0 {
+		c.statusTimer--
+		if c.statusTimer == 0 {
+			c.setStatus("")
+		}
+	}
+}
+
+// render outputs the display and the debugger panel.
+func (c *Emulator) render(b backend.Backend) {
+	if c.debugger != nil {
+		c.showDebugger(b)
+	}
+
+	if c.statusDirty {
+		c.showStatus(b)
+	}
+
+	b.Render(c.fb)
+	c.flushTrace()
+}
+
+// flushTrace writes the buffered trace records.
+func (c *Emulator) flushTrace() error {
+	if c.tracer == nil {
+		return nil
+	}
+	return c.tracer.flush()
+}
+
+// Close writes what's left of the trace, returning the first error writing
+// it. It must be called before closing the trace writer.
+func (c *Emulator) Close() error {
+	return c.flushTrace()
+}
+
+// Pause stops the CPU and the timers until Resume is called. The display is
+// still rendered and the hotkeys handled. It's safe to call from any goroutine.
+func (c *Emulator) Pause() {
+	c.paused.Store(true)
+}
+
+// Resume carries on after Pause.
+func (c *Emulator) Resume() {
+	c.paused.Store(false)
+}
+
+// Paused reports whether the emulator is paused by Pause.
+func (c *Emulator) Paused() bool {
+	return c.paused.Load()
+}
+
+// Poke writes v to memory at addr, e.g. to preselect the test to run in a test ROM.
+func (c *Emulator) Poke(addr uint16, v uint8) {
+	c.memory[addr] = v
+}
+
+func (c *Emulator) command(cmd input.Command) {
+	switch cmd {
+	case input.SaveState:
+		err := c.saveSlot(c.stateSlot)
+		if err != nil {
+			c.setStatus("save state %d: %s", c.stateSlot, err)
+			return
+		}
+		c.setStatus("saved state %d", c.stateSlot)
+	case input.LoadState:
+		err := c.loadSlot(c.stateSlot)
+		if err != nil {
+			c.setStatus("load state %d: %s", c.stateSlot, err)
+			return
+		}
+		c.setStatus("loaded state %d", c.stateSlot)
+	case input.NextSlot:
+		c.stateSlot++
+		if c.stateSlot > maxStateSlot {
+			c.stateSlot = minStateSlot
+		}
+		c.setStatus("state slot %d", c.stateSlot)
+	case input.Rewind:
+		c.rewinding = c.rewind != nil
+	case input.TogglePause:
+		if c.debugger != nil {
+			c.debugger.togglePause()
+		}
+	case input.Step:
+		if c.debugger != nil {
+			c.debugger.stepInto()
+		}
+	case input.StepOver:
+		if c.debugger != nil {
+			c.debugger.stepOver(c)
+		}
+	case input.ToggleBreakpoint:
+		if c.debugger != nil {
+			c.debugger.toggleBreakpoint(c.pc)
+		}
+	case input.PrevSlot:
+		c.stateSlot--
+		if c.stateSlot < minStateSlot {
+			c.stateSlot = maxStateSlot
+		}
+		c.setStatus("state slot %d", c.stateSlot)
+	case input.Quit:
+		c.quit = true
+	}
+}
+
+// cpuStopped reports whether the CPU is stopped by Pause or the debugger,
+// which stops the timers too.
+func (c *Emulator) cpuStopped() bool {
+	return c.paused.Load() || (c.debugger != nil && c.debugger.paused)
+}
+
+// canRun reports whether the CPU can execute the next instruction.
+func (c *Emulator) canRun() bool {
+	if c.halted || c.rewinding || c.waitingForVBlank || c.paused.Load() {
+		return false
+	}
+	return c.debugger == nil || c.debugger.shouldRun(c)
+}
+
+// showDebugger passes the debugger panel to the backend, or logs it when the
+// CPU stops if the backend can't show it.
+func (c *Emulator) showDebugger(b backend.Backend) {
+	if pr, ok := b.(display.PanelRenderer); ok {
+		pr.RenderPanel(c.debugger.panel(c))
+		c.debugger.stopped = false
+		return
+	}
+	if c.debugger.stopped {
+		log.Printf("debugger:\n%s", strings.Join(c.debugger.panel(c), "\n"))
+		c.debugger.stopped = false
+	}
+}
+
+// statusFrames is how long status messages are shown.
+const statusFrames = 3 * 60
+
+// setStatus sets the status message shown to the user for a few seconds.
+func (c *Emulator) setStatus(format string, args ...any) {
+	c.status = fmt.Sprintf(format, args...)
+	c.statusTimer = statusFrames
+	if c.status == "" {
+		c.statusTimer = 0
+	}
+	c.statusDirty = true
+}
+
+// showStatus passes the status message to the backend, or logs it if the
+// backend can't show it.
+func (c *Emulator) showStatus(b backend.Backend) {
+	c.statusDirty = false
+	if sr, ok := b.(display.StatusRenderer); ok {
+		sr.RenderStatus(c.status)
+		return
+	}
+	if c.status != "" {
+		log.Print(c.status)
+	}
+}
+
+// tick executes the instruction at pc, returning its fault if any.
+func (c *Emulator) tick() error {
+	c.opPC = c.pc
+	c.fault = nil
+	if int(c.pc) > c.memorySize()-2 {
+		c.raise(ErrPCOutOfBounds)
+		return c.fault
+	}
+	if len(c.watchpoints) > 0 {
+		c.watch(c.pc, Exec, c.memory[c.pc])
+	}
+
+	if c.tracer != nil {
+		c.tracer.before(c)
+	}
+
+	opcode := c.opcodeAt(c.pc)
+	c.pcUP()
 
 	ins := parseInstruction(opcode)
 	ins.run(c)
+
+	if c.tracer != nil {
+		c.tracer.after(c)
+	}
+	return c.fault
+}
+
+func (c *Emulator) opcodeAt(addr uint16) uint16 {
+	return uint16(c.memory[addr])<<8 | uint16(c.memory[addr+1])
 }
 
 func (c *Emulator) updateTimers() {
@@ -120,10 +612,42 @@ func (c *Emulator) pcUP() {
 	c.pc += 2
 }
 
+// skip skips the next instruction, which on XO-CHIP may be the 4 bytes long F000 NNNN.
+func (c *Emulator) skip() {
+	if c.platform == XOCHIP && c.memory[c.pc] == 0xF0 && c.memory[c.pc+1] == 0x00 {
+		c.pcUP()
+	}
+	c.pcUP()
+}
+
 func (c *Emulator) pcDown() {
 	c.pc -= 2
 }
 
+// scrollDistance returns the number of pixels to scroll by in the current resolution.
+func (c *Emulator) scrollDistance(n int) int {
+	if c.quirks.HalfScroll && !c.fb.HiRes {
+		return n / 2
+	}
+	return n
+}
+
+// scroll moves the selected planes of the display by dx, dy pixels.
+func (c *Emulator) scroll(dx, dy int) {
+	w, h := c.fb.Width(), c.fb.Height()
+	src := c.fb.Pixels
+	for x := range w {
+		for y := range h {
+			var v uint8
+			sx, sy := x-dx, y-dy
+			if sx >= 0 && sx < w && sy >= 0 && sy < h {
+				v = src[sx][sy] & c.planes
+			}
+			c.fb.Pixels[x][y] = c.fb.Pixels[x][y]&^c.planes | v
+		}
+	}
+}
+
 func (c *Emulator) flag(value bool) {
 	if value {
 		c.registers[0xF] = 1
@@ -0,0 +1,471 @@
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ruggi/c8/internal/backend/headless"
+	"github.com/ruggi/c8/internal/input"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform Platform
+		addr     uint16
+		size     int
+		want     error
+	}{
+		{"default", VIP, 0, 2, nil},
+		{"eti660", ETI660, 0, 0x1000 - 0x600, nil},
+		{"full", VIP, 0x200, 0x1000 - 0x200, nil},
+		{"last address", VIP, 0xFFF, 1, nil},
+		{"xo-chip full", XOCHIP, 0x200, 0x10000 - 0x200, nil},
+		{"empty", VIP, 0x200, 0, ErrEmptyROM},
+		{"too large", VIP, 0x200, 0x1000 - 0x200 + 1, ErrROMTooLarge},
+		{"eti660 too large", ETI660, 0, 0x1000 - 0x600 + 1, ErrROMTooLarge},
+		{"below 0x200", VIP, 0x1FF, 2, ErrInvalidLoadAddress},
+		{"past memory", VIP, 0x1000, 2, ErrInvalidLoadAddress},
+		{"past xo-chip memory", SCHIPModern, 0x8000, 2, ErrInvalidLoadAddress},
+		{"xo-chip high address", XOCHIP, 0x8000, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var k keypad
+			c := New(&k, Options{Platform: tt.platform, LoadAddress: tt.addr})
+			rom := make([]byte, tt.size)
+			for i := range rom {
+				rom[i] = 0xAB
+			}
+
+			err := c.Load(rom)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			start := int(c.loadAddress)
+			if c.pc != c.loadAddress || c.memory[start] != 0xAB || c.memory[start+len(rom)-1] != 0xAB {
+				t.Fatalf("rom not loaded at %#x", start)
+			}
+		})
+	}
+}
+
+func TestRunInvalidClock(t *testing.T) {
+	tests := []struct {
+		name  string
+		clock Clock
+	}{
+		{"no cpu rate", Clock{CPURate: 0, RenderRate: 60}},
+		{"negative cpu rate", Clock{CPURate: -1, RenderRate: 60}},
+		{"no render rate", Clock{CPURate: 600, RenderRate: 0}},
+		{"negative ipf", Clock{CPURate: 600, RenderRate: 60, InstructionsPerFrame: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := headless.New("test")
+			c := New(b, Options{})
+			if err := c.Load([]byte{0x12, 0x00}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := c.Run(context.Background(), b, tt.clock)
+			if !errors.Is(err, ErrInvalidClock) {
+				t.Fatalf("got %v, want %v", err, ErrInvalidClock)
+			}
+		})
+	}
+}
+
+// runOps runs the given opcodes on the platform, after setup.
+func runOps(t *testing.T, platform Platform, setup func(c *Emulator), ops ...uint16) *Emulator {
+	t.Helper()
+
+	var k keypad
+	c := New(&k, Options{Platform: platform, Quirks: platform.Quirks()})
+	var rom []byte
+	for _, op := range ops {
+		rom = append(rom, byte(op>>8), byte(op))
+	}
+	if err := c.Load(rom); err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		setup(c)
+	}
+	for range ops {
+		if err := c.tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// lit returns the lit pixels of the display.
+func lit(c *Emulator) [][2]int {
+	var pixels [][2]int
+	for x := range c.fb.Width() {
+		for y := range c.fb.Height() {
+			if c.fb.Pixels[x][y] != 0 {
+				pixels = append(pixels, [2]int{x, y})
+			}
+		}
+	}
+	return pixels
+}
+
+func TestExit(t *testing.T) {
+	rom := []byte{0x00, 0xE0, 0x00, 0xFD, 0x12, 0x00}
+
+	t.Run("run", func(t *testing.T) {
+		b, _ := headless.New("test")
+		c := New(b, Options{})
+		if err := c.Load(rom); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := c.Run(ctx, b, Clock{CPURate: 1000, RenderRate: 60})
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+		if c.pc != 0x204 {
+			t.Fatalf("PC %04X after exiting", c.pc)
+		}
+	})
+
+	t.Run("frames", func(t *testing.T) {
+		b, _ := headless.New("test")
+		c := New(b, Options{})
+		if err := c.Load(rom); err != nil {
+			t.Fatal(err)
+		}
+		c.delayTimer = 10
+
+		if err := c.RunFrames(b, 5, 10); err != nil {
+			t.Fatal(err)
+		}
+		// the frame the program exits in still ends
+		if c.delayTimer != 9 {
+			t.Fatalf("DT %d, want 9 after a single frame", c.delayTimer)
+		}
+	})
+}
+
+// loopROM adds 1 to v0 forever.
+var loopROM = []byte{0x70, 0x01, 0x12, 0x00}
+
+func TestRunCancel(t *testing.T) {
+	t.Run("before running", func(t *testing.T) {
+		b, _ := headless.New("test")
+		c := New(b, Options{})
+		if err := c.Load(loopROM); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := c.Run(ctx, b, Clock{CPURate: 1000, RenderRate: 60})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want %v", err, context.Canceled)
+		}
+		if c.pc != 0x200 {
+			t.Fatalf("PC %04X after cancelling", c.pc)
+		}
+	})
+
+	t.Run("while running", func(t *testing.T) {
+		b, _ := headless.New("test")
+		c := New(b, Options{})
+		if err := c.Load(loopROM); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		done := make(chan error)
+		go func() { done <- c.Run(ctx, b, Clock{CPURate: 1000, RenderRate: 60}) }()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v, want %v", err, context.Canceled)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run didn't return after cancelling")
+		}
+	})
+}
+
+func TestPause(t *testing.T) {
+	b, _ := headless.New("test")
+	c := New(b, Options{})
+	if err := c.Load(loopROM); err != nil {
+		t.Fatal(err)
+	}
+	c.delayTimer = 10
+	c.soundTimer = 10
+
+	c.Pause()
+	if !c.Paused() {
+		t.Fatal("not paused")
+	}
+	if err := c.RunFrames(b, 5, 10); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != 0x200 || c.registers[0] != 0 {
+		t.Fatalf("PC %04X, V0 %d while paused", c.pc, c.registers[0])
+	}
+	if c.delayTimer != 10 || c.soundTimer != 10 || b.Buzzes() != 0 {
+		t.Fatalf("DT %d, ST %d, %d buzzes while paused", c.delayTimer, c.soundTimer, b.Buzzes())
+	}
+	// the display is still rendered
+	if got := b.Frames(); got != 5 {
+		t.Fatalf("rendered %d frames, want 5", got)
+	}
+
+	c.Resume()
+	if c.Paused() {
+		t.Fatal("still paused")
+	}
+	if err := c.RunFrames(b, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if c.registers[0] != 5 || c.delayTimer != 9 || c.soundTimer != 9 {
+		t.Fatalf("V0 %d, DT %d, ST %d after resuming", c.registers[0], c.delayTimer, c.soundTimer)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	t.Run("run", func(t *testing.T) {
+		b, _ := headless.New("test")
+		c := New(b, Options{})
+		if err := c.Load(loopROM); err != nil {
+			t.Fatal(err)
+		}
+		b.Command(input.Quit)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := c.Run(ctx, b, Clock{CPURate: 1000, RenderRate: 60})
+		if err != nil {
+			t.Fatalf("got %v, want nil", err)
+		}
+	})
+
+	t.Run("frames", func(t *testing.T) {
+		b, _ := headless.New("test")
+		c := New(b, Options{})
+		if err := c.Load(loopROM); err != nil {
+			t.Fatal(err)
+		}
+		b.Command(input.Quit)
+
+		if err := c.RunFrames(b, 10, 10); err != nil {
+			t.Fatal(err)
+		}
+		// the command is handled at the end of the first frame
+		if c.registers[0] != 5 || b.Frames() != 1 {
+			t.Fatalf("V0 %d, %d frames after quitting", c.registers[0], b.Frames())
+		}
+	})
+}
+
+func TestResolution(t *testing.T) {
+	c := runOps(t, SCHIPModern, func(c *Emulator) { c.fb.Pixels[1][1] = 1 }, 0x00FF)
+	if !c.fb.HiRes || c.fb.Width() != 128 || len(lit(c)) != 0 {
+		t.Fatalf("00FF: hi-res %v, width %d, %d lit pixels", c.fb.HiRes, c.fb.Width(), len(lit(c)))
+	}
+
+	c = runOps(t, SCHIPModern, func(c *Emulator) { c.fb.Pixels[1][1] = 1 }, 0x00FF, 0x00FE)
+	if c.fb.HiRes || c.fb.Width() != 64 || len(lit(c)) != 0 {
+		t.Fatalf("00FE: hi-res %v, width %d, %d lit pixels", c.fb.HiRes, c.fb.Width(), len(lit(c)))
+	}
+}
+
+func TestScroll(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform Platform
+		hires    bool
+		op       uint16
+		want     [2]int
+	}{
+		{"down", SCHIPModern, false, 0x00C2, [2]int{8, 10}},
+		{"right", SCHIPModern, false, 0x00FB, [2]int{12, 8}},
+		{"left", SCHIPModern, false, 0x00FC, [2]int{4, 8}},
+		{"down hi-res", SCHIPModern, true, 0x00C2, [2]int{8, 10}},
+		{"half down", SCHIPLegacy, false, 0x00C2, [2]int{8, 9}},
+		{"half right", SCHIPLegacy, false, 0x00FB, [2]int{10, 8}},
+		{"half left", SCHIPLegacy, false, 0x00FC, [2]int{6, 8}},
+		{"half down hi-res", SCHIPLegacy, true, 0x00C2, [2]int{8, 10}},
+		{"half right hi-res", SCHIPLegacy, true, 0x00FB, [2]int{12, 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := runOps(t, tt.platform, func(c *Emulator) {
+				c.fb.HiRes = tt.hires
+				c.fb.Pixels[8][8] = 1
+			}, tt.op)
+
+			got := lit(c)
+			if len(got) != 1 || got[0] != tt.want {
+				t.Fatalf("lit %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// pixels scrolled off the edge are lost
+	c := runOps(t, SCHIPModern, func(c *Emulator) { c.fb.Pixels[62][31] = 1 }, 0x00FB, 0x00FC)
+	if got := lit(c); len(got) != 0 {
+		t.Fatalf("lit %v after scrolling off the edge and back", got)
+	}
+}
+
+func TestBigSprite(t *testing.T) {
+	sprite := func(c *Emulator) {
+		c.fb.HiRes = true
+		c.index = 0x300
+		for i := range 32 {
+			c.memory[0x300+i] = 0xFF
+		}
+		c.registers[1] = 10
+	}
+
+	// D110 draws 16x16 pixels at (10, 10)
+	c := runOps(t, SCHIPModern, sprite, 0xD110)
+	got := lit(c)
+	if len(got) != 16*16 || got[0] != [2]int{10, 10} || got[len(got)-1] != [2]int{25, 25} || c.registers[0xF] != 0 {
+		t.Fatalf("%d lit pixels from %v to %v, VF %d", len(got), got[0], got[len(got)-1], c.registers[0xF])
+	}
+
+	c = runOps(t, SCHIPModern, sprite, 0xD110, 0xD110)
+	if got := lit(c); len(got) != 0 || c.registers[0xF] != 1 {
+		t.Fatalf("%d lit pixels, VF %d after drawing twice", len(got), c.registers[0xF])
+	}
+}
+
+func TestCollisionRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform Platform
+		hires    bool
+		y        uint8
+		ops      []uint16
+		want     uint8
+	}{
+		{"rows collided", SCHIPLegacy, true, 0, []uint16{0xD010, 0xD010}, 16},
+		{"rows clipped", SCHIPLegacy, true, 56, []uint16{0xD010}, 8},
+		{"rows collided and clipped", SCHIPLegacy, true, 56, []uint16{0xD010, 0xD010}, 16},
+		{"lo-res flag", SCHIPLegacy, false, 0, []uint16{0xD010, 0xD010}, 1},
+		{"without the quirk", SCHIPModern, true, 0, []uint16{0xD010, 0xD010}, 1},
+		{"without the quirk clipped", SCHIPModern, true, 56, []uint16{0xD010}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := runOps(t, tt.platform, func(c *Emulator) {
+				c.fb.HiRes = tt.hires
+				c.index = 0x300
+				for i := range 32 {
+					c.memory[0x300+i] = 0xFF
+				}
+				c.registers[1] = tt.y
+			}, tt.ops...)
+
+			if c.registers[0xF] != tt.want {
+				t.Fatalf("VF %d, want %d", c.registers[0xF], tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayWait(t *testing.T) {
+	// draws a pixel, adds 1 to v0 twice and loops forever
+	rom := []byte{0xA2, 0x0A, 0xD0, 0x11, 0x70, 0x01, 0x70, 0x01, 0x12, 0x08, 0x80}
+
+	tests := []struct {
+		name  string
+		quirk bool
+		want  uint8 // v0 after the first frame
+	}{
+		{"waits", true, 0},
+		{"doesn't wait", false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := headless.New("test")
+			c := New(b, Options{Quirks: Quirks{DisplayWait: tt.quirk}})
+			if err := c.Load(rom); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := c.RunFrames(b, 1, 10); err != nil {
+				t.Fatal(err)
+			}
+			if c.registers[0] != tt.want {
+				t.Fatalf("V0 %d after the first frame, want %d", c.registers[0], tt.want)
+			}
+			if len(lit(c)) != 1 {
+				t.Fatal("sprite not drawn in the first frame")
+			}
+
+			// the program carries on in the next frame
+			if err := c.RunFrames(b, 1, 10); err != nil {
+				t.Fatal(err)
+			}
+			if c.registers[0] != 2 || c.pc != 0x208 {
+				t.Fatalf("V0 %d, PC %04X after the second frame", c.registers[0], c.pc)
+			}
+		})
+	}
+}
+
+func TestBigFont(t *testing.T) {
+	for digit := range uint8(10) {
+		c := runOps(t, SCHIPModern, func(c *Emulator) { c.registers[3] = digit }, 0xF330)
+		want := bigFontStart + uint16(digit)*10
+		if c.index != want {
+			t.Fatalf("digit %d: I %04X, want %04X", digit, c.index, want)
+		}
+		if !bytes.Equal(c.memory[c.index:c.index+10], bigFont[digit*10:digit*10+10]) {
+			t.Fatalf("digit %d: sprite %X", digit, c.memory[c.index:c.index+10])
+		}
+	}
+}
+
+func TestFlagRegisters(t *testing.T) {
+	c := runOps(t, SCHIPModern, func(c *Emulator) {
+		for i := range c.registers {
+			c.registers[i] = uint8(i + 1)
+		}
+	}, 0xF375, 0x6000, 0x6100, 0x6200, 0x6300, 0x6400, 0xF385)
+
+	want := [16]uint8{1, 2, 3, 4, 0, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	if c.registers != want {
+		t.Fatalf("registers %v, want %v", c.registers, want)
+	}
+	if c.rplFlags != [16]uint8{1, 2, 3, 4} {
+		t.Fatalf("flags %v", c.rplFlags)
+	}
+}
+
+func TestRunFramesInvalid(t *testing.T) {
+	for _, ipf := range []int{0, -1} {
+		b, _ := headless.New("test")
+		c := New(b, Options{})
+		if err := c.Load([]byte{0x12, 0x00}); err != nil {
+			t.Fatal(err)
+		}
+		c.delayTimer = 10
+
+		err := c.RunFrames(b, 1, ipf)
+		if !errors.Is(err, ErrInvalidClock) || c.delayTimer != 10 {
+			t.Fatalf("ipf %d: got %v, DT %d", ipf, err, c.delayTimer)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Faults are the conditions a program can run into that a real interpreter
+// would crash or misbehave on. Instead of panicking or corrupting the state
+// of the emulator, the faulting instruction does nothing and tick returns
+// the fault, wrapped with the address of the instruction.
+var (
+	ErrStackOverflow  = errors.New("stack overflow")
+	ErrStackUnderflow = errors.New("stack underflow")
+	ErrPCOutOfBounds  = errors.New("pc out of bounds")
+)
+
+// ErrUnknownOpcode is the fault of an opcode that isn't an instruction.
+type ErrUnknownOpcode struct {
+	Addr   uint16
+	Opcode uint16
+}
+
+func (e ErrUnknownOpcode) Error() string {
+	return fmt.Sprintf("unknown opcode %04X at %04X", e.Opcode, e.Addr)
+}
+
+// FaultPolicy is what the emulator does when the CPU faults.
+type FaultPolicy string
+
+const (
+	// FaultHalt stops the emulator, Run returns the fault.
+	FaultHalt FaultPolicy = "halt"
+	// FaultIgnore carries on after the faulting instruction, halting only
+	// when the PC is out of bounds.
+	FaultIgnore FaultPolicy = "ignore"
+	// FaultDebug pauses the debugger on the faulting instruction.
+	FaultDebug FaultPolicy = "debug"
+)
+
+// FaultPolicies lists the supported fault policies.
+var FaultPolicies = []FaultPolicy{FaultHalt, FaultIgnore, FaultDebug}
+
+// ParseFaultPolicy returns the fault policy with the given name.
+func ParseFaultPolicy(name string) (FaultPolicy, error) {
+	for _, p := range FaultPolicies {
+		if string(p) == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown fault policy: %s", name)
+}
+
+// memorySize returns the size of the memory addressable by the platform.
+func (c *Emulator) memorySize() int {
+	return c.platform.MemorySize()
+}
+
+// raise faults the instruction being executed.
+func (c *Emulator) raise(err error) {
+	var unknown ErrUnknownOpcode
+	if !errors.As(err, &unknown) {
+		err = fmt.Errorf("%w at %04X", err, c.opPC)
+	}
+	c.fault = err
+}
+
+// step runs the next instruction, handling a fault as the policy says.
+func (c *Emulator) step() error {
+	err := c.tick()
+	if err == nil {
+		return nil
+	}
+
+	switch c.onFault {
+	case FaultIgnore:
+		// there's no instruction to skip past the end of memory
+		if !errors.Is(err, ErrPCOutOfBounds) {
+			return nil
+		}
+	case FaultDebug:
+		c.pc = c.opPC
+		c.debugger.fault = err
+		c.debugger.pause()
+		return nil
+	}
+
+	c.pc = c.opPC
+	c.halted = true
+	return err
+}
@@ -0,0 +1,91 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestLongLoad(t *testing.T) {
+	rom := []byte{0xF0, 0x00, 0x12, 0x34}
+
+	for _, platform := range Platforms {
+		t.Run(string(platform), func(t *testing.T) {
+			var k keypad
+			c := New(&k, Options{Platform: platform, Quirks: platform.Quirks(), LoadAddress: 0x200})
+			if err := c.Load(rom); err != nil {
+				t.Fatal(err)
+			}
+
+			err := c.tick()
+			if platform == XOCHIP {
+				if err != nil || c.index != 0x1234 || c.pc != 0x204 {
+					t.Fatalf("got err %v, I %04X, PC %04X", err, c.index, c.pc)
+				}
+				return
+			}
+
+			var unknown ErrUnknownOpcode
+			if !errors.As(err, &unknown) || unknown.Opcode != 0xF000 || unknown.Addr != 0x200 {
+				t.Fatalf("got err %v, want unknown opcode F000 at 0200", err)
+			}
+			if ins := Decode(c.memory[:], 0x200, platform); ins.Size() != 2 {
+				t.Fatalf("decoded %d bytes", ins.Size())
+			}
+		})
+	}
+}
+
+func TestXOCHIPOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode uint16
+		// ran reports whether the instruction had its effect on XO-CHIP
+		ran func(c *Emulator) bool
+	}{
+		{"scroll up", 0x00D1, func(c *Emulator) bool { return c.fb.Pixels[0][0] == 1 }},
+		{"save range", 0x5122, func(c *Emulator) bool { return c.memory[0x300] == 0x11 && c.memory[0x301] == 0x22 }},
+		{"load range", 0x5123, func(c *Emulator) bool { return c.registers[1] == 0xAA && c.registers[2] == 0xBB }},
+		{"plane", 0xF201, func(c *Emulator) bool { return c.planes == 2 }},
+		{"audio", 0xF002, func(c *Emulator) bool { return c.pattern.Buffer[0] == 0xAA && c.patternDirty }},
+		{"pitch", 0xF13A, func(c *Emulator) bool { return c.pattern.Pitch == 0x11 && c.patternDirty }},
+	}
+	for _, tt := range tests {
+		for _, platform := range Platforms {
+			t.Run(tt.name+"/"+string(platform), func(t *testing.T) {
+				var k keypad
+				c := New(&k, Options{Platform: platform, Quirks: platform.Quirks(), LoadAddress: 0x200})
+				if err := c.Load([]byte{byte(tt.opcode >> 8), byte(tt.opcode)}); err != nil {
+					t.Fatal(err)
+				}
+				c.index = 0x300
+				c.memory[0x300], c.memory[0x301] = 0xAA, 0xBB
+				c.registers[1], c.registers[2] = 0x11, 0x22
+				c.fb.Pixels[0][1] = 1
+
+				err := c.tick()
+				ins := Decode(c.memory[:], 0x200, platform)
+				if platform == XOCHIP {
+					if err != nil || !tt.ran(c) {
+						t.Fatalf("got err %v, ran %v", err, tt.ran(c))
+					}
+					if ins.Format(Classic, nil) == ins.data(Classic) {
+						t.Fatalf("decoded as data: %s", ins.Format(Classic, nil))
+					}
+					return
+				}
+
+				var unknown ErrUnknownOpcode
+				if !errors.As(err, &unknown) || unknown.Opcode != tt.opcode || unknown.Addr != 0x200 {
+					t.Fatalf("got err %v, want unknown opcode %04X at 0200", err, tt.opcode)
+				}
+				if tt.ran(c) || c.planes != 1 {
+					t.Fatal("ran on a platform without XO-CHIP")
+				}
+				if got, want := ins.Format(Octo, nil), fmt.Sprintf("0x%02X 0x%02X", tt.opcode>>8, tt.opcode&0xFF); got != want {
+					t.Fatalf("octo listing %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package emulator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ruggi/c8/internal/backend/headless"
+)
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{0x12, 0x00}, uint16(0x000), false)
+	f.Add([]byte{0xF0, 0x00, 0x12, 0x34}, uint16(0x000), true)
+	f.Add([]byte{0xF0, 0x00}, uint16(0x001), true)
+	f.Add([]byte{0x00, 0xEE, 0x5A, 0xB2, 0xFF, 0xFF}, uint16(0x002), false)
+
+	f.Fuzz(func(t *testing.T, mem []byte, addr uint16, xochip bool) {
+		platform := VIP
+		if xochip {
+			platform = XOCHIP
+		}
+
+		ins := Decode(mem, addr, platform)
+		if ins.Size() != 2 && ins.Size() != 4 {
+			t.Fatalf("instruction size %d", ins.Size())
+		}
+		if ins.Size() == 4 && platform != XOCHIP {
+			t.Fatalf("4 bytes instruction on %s", platform)
+		}
+
+		ins.Format(Classic, nil)
+		ins.Format(Octo, func(uint16) string { return "label" })
+	})
+}
+
+// FuzzEmulator runs arbitrary ROMs with arbitrary key presses, each pair of
+// bytes of keys being the keys held during a frame. Programs can crash the
+// CPU, but only through a fault halting it: the emulator must never panic.
+func FuzzEmulator(f *testing.F) {
+	const (
+		frames = 30
+		ipf    = 50
+	)
+
+	f.Add([]byte{0x22, 0x00}, []byte{}, uint8(0))                                   // stack overflow
+	f.Add([]byte{0x00, 0xEE}, []byte{}, uint8(0))                                   // stack underflow
+	f.Add([]byte{0x1F, 0xFE}, []byte{}, uint8(0))                                   // runs past the end of memory
+	f.Add([]byte{0x60, 0xFF, 0xE0, 0x9E, 0x12, 0x02}, []byte{0xFF, 0xFF}, uint8(1)) // key out of range
+	f.Add([]byte{0xF0, 0x0A, 0x12, 0x00}, []byte{0x01, 0x00, 0x00, 0x00}, uint8(2))
+	f.Add([]byte{0x00, 0xFF, 0xA2, 0x00, 0xD0, 0x10, 0x00, 0xC4, 0x00, 0xFB, 0x12, 0x04}, []byte{}, uint8(3))
+
+	f.Fuzz(func(t *testing.T, rom []byte, keys []byte, p uint8) {
+		platform := Platforms[int(p)%len(Platforms)]
+
+		b, err := headless.New("fuzz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := New(b, Options{Platform: platform, Quirks: platform.Quirks()})
+		if err := c.Load(rom[:min(len(rom), c.memorySize()-int(c.loadAddress))]); err != nil {
+			return
+		}
+
+		for frame := range frames {
+			if i := 2 * frame; i+1 < len(keys) {
+				held := uint16(keys[i])<<8 | uint16(keys[i+1])
+				for k := range uint8(16) {
+					if held&(1<<k) != 0 {
+						b.Press(k)
+					} else {
+						b.Release(k)
+					}
+				}
+			}
+
+			err := c.RunFrames(b, 1, ipf)
+			if int(c.sp) > len(c.stack) {
+				t.Fatalf("stack pointer %d out of range", c.sp)
+			}
+			if err == nil {
+				continue
+			}
+
+			var unknown ErrUnknownOpcode
+			switch {
+			case errors.Is(err, ErrStackOverflow),
+				errors.Is(err, ErrStackUnderflow),
+				errors.Is(err, ErrPCOutOfBounds),
+				errors.As(err, &unknown):
+			default:
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !c.halted {
+				t.Fatalf("fault %s didn't halt the CPU", err)
+			}
+			return
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package emulator
 
 import (
+	"fmt"
 	"math/rand"
 
 	"github.com/ruggi/c8/internal/display"
@@ -8,6 +9,8 @@ import (
 
 type instruction interface {
 	run(c *Emulator)
+	// String returns the instruction in the classic mnemonic syntax.
+	String() string
 }
 
 type instructionInput struct {
@@ -38,9 +41,24 @@ func parseInstruction(ins uint16) instruction {
 			return op00E0{}
 		case 0x0EE:
 			return op00EE{}
-		default:
-			return op0NNN{in: in}
+		case 0x0FB:
+			return op00FB{}
+		case 0x0FC:
+			return op00FC{}
+		case 0x0FD:
+			return op00FD{}
+		case 0x0FE:
+			return op00FE{}
+		case 0x0FF:
+			return op00FF{}
 		}
+		switch in.nnn & 0xFF0 {
+		case 0x0C0:
+			return op00CN{in: in}
+		case 0x0D0:
+			return op00DN{in: in}
+		}
+		return op0NNN{in: in}
 	case 0x1:
 		return op1NNN{in: in}
 	case 0x2:
@@ -50,7 +68,14 @@ func parseInstruction(ins uint16) instruction {
 	case 0x4:
 		return op4XNN{in: in}
 	case 0x5:
-		return op5XY0{in: in}
+		switch in.lsb {
+		case 0:
+			return op5XY0{in: in}
+		case 2:
+			return op5XY2{in: in}
+		case 3:
+			return op5XY3{in: in}
+		}
 	case 0x6:
 		return op6XNN{in: in}
 	case 0x7:
@@ -94,7 +119,15 @@ func parseInstruction(ins uint16) instruction {
 			return opEXA1{in: in}
 		}
 	case 0xF:
+		if ins == 0xF000 {
+			return opF000{}
+		}
+		if ins == 0xF002 {
+			return opF002{}
+		}
 		switch in.nn {
+		case 0x01:
+			return opFN01{in: in}
 		case 0x07:
 			return opFX07{in: in}
 		case 0x0A:
@@ -107,52 +140,179 @@ func parseInstruction(ins uint16) instruction {
 			return opFX1E{in: in}
 		case 0x29:
 			return opFX29{in: in}
+		case 0x30:
+			return opFX30{in: in}
 		case 0x33:
 			return opFX33{in: in}
+		case 0x3A:
+			return opFX3A{in: in}
 		case 0x55:
 			return opFX55{in: in}
 		case 0x65:
 			return opFX65{in: in}
+		case 0x75:
+			return opFX75{in: in}
+		case 0x85:
+			return opFX85{in: in}
 		}
 	}
 
-	return opUnknown{}
+	return opUnknown{opcode: ins}
+}
+
+// xochipOnly faults XO-CHIP instructions as unknown on other platforms,
+// reporting whether the instruction can run.
+func (c *Emulator) xochipOnly() bool {
+	if c.platform == XOCHIP {
+		return true
+	}
+	c.raise(ErrUnknownOpcode{Addr: c.opPC, Opcode: c.opcodeAt(c.opPC)})
+	return false
 }
 
 // opUnknown is unknown ¯\_(ツ)_/¯
-type opUnknown struct{}
+type opUnknown struct {
+	opcode uint16
+}
 
-func (u opUnknown) run(c *Emulator) {}
+func (u opUnknown) run(c *Emulator) {
+	c.raise(ErrUnknownOpcode{Addr: c.opPC, Opcode: u.opcode})
+}
 
 type op0NNN struct {
 	in *instructionInput
 }
 
+func (u opUnknown) String() string {
+	return fmt.Sprintf("DW 0x%04X", u.opcode)
+}
+
 func (o op0NNN) run(c *Emulator) {
 	// 0x0NNN - Machine language routine (no-op in most implementations)
 	// Some implementations call a machine language routine at address NNN
 	// For compatibility, we'll make this a no-op
 }
 
-// op00E0 clears the display
+func (o op0NNN) String() string {
+	return fmt.Sprintf("SYS 0x%03X", o.in.nnn)
+}
+
+// op00E0 clears the selected planes of the display
 type op00E0 struct{}
 
 func (op00E0) run(c *Emulator) {
-	for i := range c.fb {
-		for j := range c.fb[i] {
-			c.fb[i][j] = false
+	for x := range c.fb.Pixels {
+		for y := range c.fb.Pixels[x] {
+			c.fb.Pixels[x][y] &^= c.planes
 		}
 	}
 }
 
+func (op00E0) String() string {
+	return "CLS"
+}
+
 // op00EE returns from a subroutine
 type op00EE struct{}
 
 func (op00EE) run(c *Emulator) {
+	if c.sp == 0 {
+		c.raise(ErrStackUnderflow)
+		return
+	}
 	c.sp--
 	c.pc = c.stack[c.sp]
 }
 
+func (op00EE) String() string {
+	return "RET"
+}
+
+// op00CN scrolls the display down by n pixels.
+type op00CN struct {
+	in *instructionInput
+}
+
+func (o op00CN) run(c *Emulator) {
+	c.scroll(0, c.scrollDistance(int(o.in.n)))
+}
+
+func (o op00CN) String() string {
+	return fmt.Sprintf("SCD %d", o.in.n)
+}
+
+// op00DN scrolls the display up by n pixels (XO-CHIP).
+type op00DN struct {
+	in *instructionInput
+}
+
+func (o op00DN) run(c *Emulator) {
+	if !c.xochipOnly() {
+		return
+	}
+	c.scroll(0, -c.scrollDistance(int(o.in.n)))
+}
+
+func (o op00DN) String() string {
+	return fmt.Sprintf("SCU %d", o.in.n)
+}
+
+// op00FB scrolls the display right by 4 pixels.
+type op00FB struct{}
+
+func (op00FB) run(c *Emulator) {
+	c.scroll(c.scrollDistance(4), 0)
+}
+
+func (op00FB) String() string {
+	return "SCR"
+}
+
+// op00FC scrolls the display left by 4 pixels.
+type op00FC struct{}
+
+func (op00FC) run(c *Emulator) {
+	c.scroll(-c.scrollDistance(4), 0)
+}
+
+func (op00FC) String() string {
+	return "SCL"
+}
+
+// op00FD exits the interpreter.
+type op00FD struct{}
+
+func (op00FD) run(c *Emulator) {
+	c.halted = true
+	c.quit = true
+}
+
+func (op00FD) String() string {
+	return "EXIT"
+}
+
+// op00FE switches to low resolution mode and clears the display.
+type op00FE struct{}
+
+func (op00FE) run(c *Emulator) {
+	c.fb = display.Framebuffer{HiRes: false}
+}
+
+func (op00FE) String() string {
+	return "LOW"
+}
+
+// op00FF switches to high resolution mode and clears the display.
+type op00FF struct{}
+
+func (op00FF) run(c *Emulator) {
+	c.fb = display.Framebuffer{HiRes: true}
+}
+
+func (op00FF) String() string {
+	return "HIGH"
+}
+
 // op1NNN jumps to address NNN
 type op1NNN struct {
 	in *instructionInput
@@ -162,17 +322,29 @@ func (o op1NNN) run(c *Emulator) {
 	c.pc = o.in.nnn
 }
 
+func (o op1NNN) String() string {
+	return fmt.Sprintf("JP 0x%03X", o.in.nnn)
+}
+
 // op2NNN calls a subroutine at address NNN
 type op2NNN struct {
 	in *instructionInput
 }
 
 func (o op2NNN) run(c *Emulator) {
+	if int(c.sp) == len(c.stack) {
+		c.raise(ErrStackOverflow)
+		return
+	}
 	c.stack[c.sp] = c.pc
 	c.sp++
 	c.pc = o.in.nnn
 }
 
+func (o op2NNN) String() string {
+	return fmt.Sprintf("CALL 0x%03X", o.in.nnn)
+}
+
 // op3XNNN skips the next instruction if Vx == nn
 type op3XNNN struct {
 	in *instructionInput
@@ -180,10 +352,14 @@ type op3XNNN struct {
 
 func (o op3XNNN) run(c *Emulator) {
 	if c.registers[o.in.x] == o.in.nn {
-		c.pcUP()
+		c.skip()
 	}
 }
 
+func (o op3XNNN) String() string {
+	return fmt.Sprintf("SE V%X, 0x%02X", o.in.x, o.in.nn)
+}
+
 // op4XNN skips the next instruction if Vx != nn
 type op4XNN struct {
 	in *instructionInput
@@ -191,10 +367,14 @@ type op4XNN struct {
 
 func (o op4XNN) run(c *Emulator) {
 	if c.registers[o.in.x] != o.in.nn {
-		c.pcUP()
+		c.skip()
 	}
 }
 
+func (o op4XNN) String() string {
+	return fmt.Sprintf("SNE V%X, 0x%02X", o.in.x, o.in.nn)
+}
+
 // op5XY0 skips the next instruction if Vx == Vy
 type op5XY0 struct {
 	in *instructionInput
@@ -202,7 +382,63 @@ type op5XY0 struct {
 
 func (o op5XY0) run(c *Emulator) {
 	if c.registers[o.in.x] == c.registers[o.in.y] {
-		c.pcUP()
+		c.skip()
+	}
+}
+
+func (o op5XY0) String() string {
+	return fmt.Sprintf("SE V%X, V%X", o.in.x, o.in.y)
+}
+
+// op5XY2 saves Vx through Vy in memory starting at I, without changing I (XO-CHIP).
+type op5XY2 struct {
+	in *instructionInput
+}
+
+func (o op5XY2) run(c *Emulator) {
+	if !c.xochipOnly() {
+		return
+	}
+	for i, r := range registerRange(o.in.x, o.in.y) {
+		c.write(c.index+uint16(i), c.registers[r])
+	}
+}
+
+func (o op5XY2) String() string {
+	return fmt.Sprintf("SAVE V%X-V%X", o.in.x, o.in.y)
+}
+
+// op5XY3 loads Vx through Vy from memory starting at I, without changing I (XO-CHIP).
+type op5XY3 struct {
+	in *instructionInput
+}
+
+func (o op5XY3) run(c *Emulator) {
+	if !c.xochipOnly() {
+		return
+	}
+	for i, r := range registerRange(o.in.x, o.in.y) {
+		c.registers[r] = c.read(c.index + uint16(i))
+	}
+}
+
+func (o op5XY3) String() string {
+	return fmt.Sprintf("LOAD V%X-V%X", o.in.x, o.in.y)
+}
+
+// registerRange returns the registers from x to y, in descending order if x > y.
+func registerRange(x, y uint8) []uint8 {
+	step := 1
+	if x > y {
+		step = -1
+	}
+
+	var regs []uint8
+	for r := int(x); ; r += step {
+		regs = append(regs, uint8(r))
+		if r == int(y) {
+			return regs
+		}
 	}
 }
 
@@ -215,6 +451,10 @@ func (o op6XNN) run(c *Emulator) {
 	c.registers[o.in.x] = o.in.nn
 }
 
+func (o op6XNN) String() string {
+	return fmt.Sprintf("LD V%X, 0x%02X", o.in.x, o.in.nn)
+}
+
 // op7XNN sets Vx to Vx + nn
 type op7XNN struct {
 	in *instructionInput
@@ -224,6 +464,10 @@ func (o op7XNN) run(c *Emulator) {
 	c.registers[o.in.x] += o.in.nn
 }
 
+func (o op7XNN) String() string {
+	return fmt.Sprintf("ADD V%X, 0x%02X", o.in.x, o.in.nn)
+}
+
 // op8XY0 sets Vx to Vy
 type op8XY0 struct {
 	in *instructionInput
@@ -233,6 +477,10 @@ func (o op8XY0) run(c *Emulator) {
 	c.registers[o.in.x] = c.registers[o.in.y]
 }
 
+func (o op8XY0) String() string {
+	return fmt.Sprintf("LD V%X, V%X", o.in.x, o.in.y)
+}
+
 // op8XY1 sets Vx to Vx OR Vy
 type op8XY1 struct {
 	in *instructionInput
@@ -240,6 +488,13 @@ type op8XY1 struct {
 
 func (o op8XY1) run(c *Emulator) {
 	c.registers[o.in.x] |= c.registers[o.in.y]
+	if c.quirks.VFReset {
+		c.registers[0xF] = 0
+	}
+}
+
+func (o op8XY1) String() string {
+	return fmt.Sprintf("OR V%X, V%X", o.in.x, o.in.y)
 }
 
 // op8XY2 sets Vx to Vx AND Vy
@@ -249,6 +504,13 @@ type op8XY2 struct {
 
 func (o op8XY2) run(c *Emulator) {
 	c.registers[o.in.x] &= c.registers[o.in.y]
+	if c.quirks.VFReset {
+		c.registers[0xF] = 0
+	}
+}
+
+func (o op8XY2) String() string {
+	return fmt.Sprintf("AND V%X, V%X", o.in.x, o.in.y)
 }
 
 // op8XY3 sets Vx to Vx XOR Vy
@@ -258,6 +520,13 @@ type op8XY3 struct {
 
 func (o op8XY3) run(c *Emulator) {
 	c.registers[o.in.x] ^= c.registers[o.in.y]
+	if c.quirks.VFReset {
+		c.registers[0xF] = 0
+	}
+}
+
+func (o op8XY3) String() string {
+	return fmt.Sprintf("XOR V%X, V%X", o.in.x, o.in.y)
 }
 
 // op8XY4 sets Vx to Vx + Vy, and carry.
@@ -267,9 +536,12 @@ type op8XY4 struct {
 
 func (o op8XY4) run(c *Emulator) {
 	sum := uint16(c.registers[o.in.x]) + uint16(c.registers[o.in.y])
+	c.registers[o.in.x] = uint8(sum)
 	c.flag(sum > 0xFF)
+}
 
-	c.registers[o.in.x] = uint8(sum)
+func (o op8XY4) String() string {
+	return fmt.Sprintf("ADD V%X, V%X", o.in.x, o.in.y)
 }
 
 // op8XY5 sets Vx to Vx - Vy, and borrow.
@@ -278,9 +550,13 @@ type op8XY5 struct {
 }
 
 func (o op8XY5) run(c *Emulator) {
-	diff := int8(c.registers[o.in.x]) - int8(c.registers[o.in.y])
-	c.registers[o.in.x] = uint8(diff)
-	c.flag(diff >= 0)
+	vx, vy := c.registers[o.in.x], c.registers[o.in.y]
+	c.registers[o.in.x] = vx - vy
+	c.flag(vx >= vy)
+}
+
+func (o op8XY5) String() string {
+	return fmt.Sprintf("SUB V%X, V%X", o.in.x, o.in.y)
 }
 
 // op8XY6 sets Vx to Vx SHIFT RIGHT.
@@ -289,8 +565,16 @@ type op8XY6 struct {
 }
 
 func (o op8XY6) run(c *Emulator) {
-	c.flag(c.registers[o.in.x]%2 == 1)
-	c.registers[o.in.x] = c.registers[o.in.y] / 2
+	src := c.registers[o.in.y]
+	if c.quirks.Shifting {
+		src = c.registers[o.in.x]
+	}
+	c.registers[o.in.x] = src >> 1
+	c.flag(src&0x1 == 0x1)
+}
+
+func (o op8XY6) String() string {
+	return fmt.Sprintf("SHR V%X, V%X", o.in.x, o.in.y)
 }
 
 // op8XY7 sets Vx to Vy - Vx, and borrow.
@@ -299,9 +583,13 @@ type op8XY7 struct {
 }
 
 func (o op8XY7) run(c *Emulator) {
-	diff := c.registers[o.in.y] - c.registers[o.in.x]
-	c.registers[o.in.x] = diff
-	c.flag(c.registers[o.in.y] >= c.registers[o.in.x])
+	vx, vy := c.registers[o.in.x], c.registers[o.in.y]
+	c.registers[o.in.x] = vy - vx
+	c.flag(vy >= vx)
+}
+
+func (o op8XY7) String() string {
+	return fmt.Sprintf("SUBN V%X, V%X", o.in.x, o.in.y)
 }
 
 // op8XYE sets Vx to Vx SHIFT LEFT.
@@ -310,8 +598,16 @@ type op8XYE struct {
 }
 
 func (o op8XYE) run(c *Emulator) {
-	c.flag(c.registers[o.in.x]&0x80 == 0x80)
-	c.registers[o.in.x] = c.registers[o.in.y] << 1
+	src := c.registers[o.in.y]
+	if c.quirks.Shifting {
+		src = c.registers[o.in.x]
+	}
+	c.registers[o.in.x] = src << 1
+	c.flag(src&0x80 == 0x80)
+}
+
+func (o op8XYE) String() string {
+	return fmt.Sprintf("SHL V%X, V%X", o.in.x, o.in.y)
 }
 
 // op9XY0 skips the next instruction if Vx != Vy.
@@ -321,10 +617,14 @@ type op9XY0 struct {
 
 func (o op9XY0) run(c *Emulator) {
 	if c.registers[o.in.x] != c.registers[o.in.y] {
-		c.pcUP()
+		c.skip()
 	}
 }
 
+func (o op9XY0) String() string {
+	return fmt.Sprintf("SNE V%X, V%X", o.in.x, o.in.y)
+}
+
 // opANNN sets I to nnn.
 type opANNN struct {
 	in *instructionInput
@@ -334,16 +634,27 @@ func (o opANNN) run(c *Emulator) {
 	c.index = o.in.nnn
 }
 
-// opBNNN jumps to location nnn + V0.
+func (o opANNN) String() string {
+	return fmt.Sprintf("LD I, 0x%03X", o.in.nnn)
+}
+
+// opBNNN jumps to location nnn + V0, or xnn + Vx with the jumping quirk.
 type opBNNN struct {
 	in *instructionInput
 }
 
 func (o opBNNN) run(c *Emulator) {
-	// Jump to location nnn + V0.
+	if c.quirks.Jumping {
+		c.pc = uint16(c.registers[o.in.x]) + o.in.nnn
+		return
+	}
 	c.pc = uint16(c.registers[0]) + o.in.nnn
 }
 
+func (o opBNNN) String() string {
+	return fmt.Sprintf("JP V0, 0x%03X", o.in.nnn)
+}
+
 type opCXNN struct {
 	in *instructionInput
 }
@@ -352,57 +663,174 @@ func (o opCXNN) run(c *Emulator) {
 	c.registers[o.in.x] = uint8(rand.Intn(256)) & o.in.nn
 }
 
+func (o opCXNN) String() string {
+	return fmt.Sprintf("RND V%X, 0x%02X", o.in.x, o.in.nn)
+}
+
 // opDXYN draws a sprite at position Vx, Vy with n bytes of sprite data starting at memory address I.
+// With n == 0 a 16x16 sprite made of 32 bytes is drawn instead (SUPER-CHIP).
+// When both XO-CHIP planes are selected, the sprite data for the second plane follows the first one.
+// With the display wait quirk the CPU then waits for the next frame.
 type opDXYN struct {
 	in *instructionInput
 }
 
 func (o opDXYN) run(c *Emulator) {
-	c.flag(false)
+	c.waitingForVBlank = c.quirks.DisplayWait
 
-	for i := uint8(0); i < o.in.n; i++ {
-		spriteRow := c.memory[c.index+uint16(i)]
+	w, h := c.fb.Width(), c.fb.Height()
+	rows, cols := int(o.in.n), 8
+	if o.in.n == 0 {
+		rows, cols = 16, 16
+	}
+	bytesPerRow := cols / 8
+
+	// the starting position always wraps around
+	x0 := int(c.registers[o.in.x]) % w
+	y0 := int(c.registers[o.in.y]) % h
+
+	collisions, clipped := 0, 0
+	addr := c.index
+	for p := range uint8(display.Planes) {
+		plane := uint8(1) << p
+		if c.planes&plane == 0 {
+			continue
+		}
 
-		for j := uint8(0); j < 8; j++ {
-			pixel := spriteRow & (0x80 >> j)
-			if pixel == 0 {
-				continue
+		for i := range rows {
+			var spriteRow uint16
+			for range bytesPerRow {
+				spriteRow = spriteRow<<8 | uint16(c.read(addr))
+				addr++
 			}
-			col := (c.registers[o.in.x] + j) % display.Width
-			row := (c.registers[o.in.y] + i) % display.Height
 
-			fbValue := c.fb[col][row]
-			c.fb[col][row] = !fbValue
+			row := y0 + i
+			if row >= h {
+				if c.quirks.Clipping {
+					clipped++
+					continue
+				}
+				row %= h
+			}
 
-			if fbValue { // it means it flipped
-				c.flag(true)
+			collided := false
+			for j := range cols {
+				pixel := spriteRow & (1 << (cols - 1 - j))
+				if pixel == 0 {
+					continue
+				}
+				col := x0 + j
+				if col >= w {
+					if c.quirks.Clipping {
+						continue
+					}
+					col %= w
+				}
+
+				fbValue := c.fb.Pixels[col][row]
+				c.fb.Pixels[col][row] ^= plane
+
+				if fbValue&plane != 0 { // it means it flipped
+					collided = true
+				}
+			}
+			if collided {
+				collisions++
 			}
 		}
 	}
+
+	if c.quirks.CollisionRows && c.fb.HiRes {
+		c.registers[0xF] = uint8(collisions + clipped)
+		return
+	}
+	c.flag(collisions > 0)
+}
+
+func (o opDXYN) String() string {
+	return fmt.Sprintf("DRW V%X, V%X, %d", o.in.x, o.in.y, o.in.n)
 }
 
 // opEX9E skips the next instruction if the key with the value of Vx is pressed.
+// Only the low nibble of Vx selects the key, as on the COSMAC VIP.
 type opEX9E struct {
 	in *instructionInput
 }
 
 func (o opEX9E) run(c *Emulator) {
 	keys := c.input.GetKeys()
-	if keys[c.registers[o.in.x]] {
-		c.pcUP()
+	if keys[c.registers[o.in.x]&0xF] {
+		c.skip()
 	}
 }
 
+func (o opEX9E) String() string {
+	return fmt.Sprintf("SKP V%X", o.in.x)
+}
+
 // opEXA1 skips the next instruction if the key with the value of Vx is not pressed.
+// Only the low nibble of Vx selects the key, as on the COSMAC VIP.
 type opEXA1 struct {
 	in *instructionInput
 }
 
 func (o opEXA1) run(c *Emulator) {
 	keys := c.input.GetKeys()
-	if !keys[c.registers[o.in.x]] {
-		c.pcUP()
+	if !keys[c.registers[o.in.x]&0xF] {
+		c.skip()
+	}
+}
+
+func (o opEXA1) String() string {
+	return fmt.Sprintf("SKNP V%X", o.in.x)
+}
+
+// opF000 sets I to the 16 bit address stored in the next two bytes (XO-CHIP).
+type opF000 struct{}
+
+func (opF000) run(c *Emulator) {
+	if !c.xochipOnly() {
+		return
+	}
+	c.index = uint16(c.read(c.pc))<<8 | uint16(c.read(c.pc+1))
+	c.pcUP()
+}
+
+func (opF000) String() string {
+	return "LD I, LONG"
+}
+
+// opFN01 selects the bitplanes to draw on (XO-CHIP).
+type opFN01 struct {
+	in *instructionInput
+}
+
+func (o opFN01) run(c *Emulator) {
+	if !c.xochipOnly() {
+		return
+	}
+	c.planes = o.in.x & 0x3
+}
+
+func (o opFN01) String() string {
+	return fmt.Sprintf("PLANE %d", o.in.x)
+}
+
+// opF002 loads the 16 bytes audio pattern starting at I (XO-CHIP).
+type opF002 struct{}
+
+func (opF002) run(c *Emulator) {
+	if !c.xochipOnly() {
+		return
+	}
+	for i := range c.pattern.Buffer {
+		c.pattern.Buffer[i] = c.read(c.index + uint16(i))
 	}
+	c.patternDirty = true
+}
+
+func (opF002) String() string {
+	return "AUDIO"
 }
 
 // opFX0A waits for a key press, stores the value of the key in Vx.
@@ -430,6 +858,10 @@ func (o opFX0A) run(c *Emulator) {
 	c.pcDown()
 }
 
+func (o opFX0A) String() string {
+	return fmt.Sprintf("LD V%X, K", o.in.x)
+}
+
 // opFX1E adds the value of Vx to I.
 type opFX1E struct {
 	in *instructionInput
@@ -439,6 +871,10 @@ func (o opFX1E) run(c *Emulator) {
 	c.index += uint16(c.registers[o.in.x])
 }
 
+func (o opFX1E) String() string {
+	return fmt.Sprintf("ADD I, V%X", o.in.x)
+}
+
 // opFX07 sets Vx to the value of the delay timer.
 type opFX07 struct {
 	in *instructionInput
@@ -448,6 +884,10 @@ func (o opFX07) run(c *Emulator) {
 	c.registers[o.in.x] = c.delayTimer
 }
 
+func (o opFX07) String() string {
+	return fmt.Sprintf("LD V%X, DT", o.in.x)
+}
+
 // opFX15 sets the delay timer to the value of Vx.
 type opFX15 struct {
 	in *instructionInput
@@ -457,6 +897,10 @@ func (o opFX15) run(c *Emulator) {
 	c.delayTimer = c.registers[o.in.x]
 }
 
+func (o opFX15) String() string {
+	return fmt.Sprintf("LD DT, V%X", o.in.x)
+}
+
 // opFX18 sets the sound timer to the value of Vx.
 type opFX18 struct {
 	in *instructionInput
@@ -466,13 +910,34 @@ func (o opFX18) run(c *Emulator) {
 	c.soundTimer = c.registers[o.in.x]
 }
 
+func (o opFX18) String() string {
+	return fmt.Sprintf("LD ST, V%X", o.in.x)
+}
+
 // opFX29 sets I to the location of the sprite for the character in Vx.
 type opFX29 struct {
 	in *instructionInput
 }
 
 func (o opFX29) run(c *Emulator) {
-	c.index = uint16(c.registers[o.in.x]) * 5
+	c.index = fontStart + uint16(c.registers[o.in.x]&0xF)*5
+}
+
+func (o opFX29) String() string {
+	return fmt.Sprintf("LD F, V%X", o.in.x)
+}
+
+// opFX30 sets I to the location of the big sprite for the character in Vx (SUPER-CHIP).
+type opFX30 struct {
+	in *instructionInput
+}
+
+func (o opFX30) run(c *Emulator) {
+	c.index = bigFontStart + uint16(c.registers[o.in.x]&0xF)*10
+}
+
+func (o opFX30) String() string {
+	return fmt.Sprintf("LD HF, V%X", o.in.x)
 }
 
 // opFX33 decodes the decimal value of Vx into three digits and stores them in memory at locations I, I+1, and I+2.
@@ -481,9 +946,30 @@ type opFX33 struct {
 }
 
 func (o opFX33) run(c *Emulator) {
-	c.memory[c.index] = (c.registers[o.in.x] / 100) % 10
-	c.memory[c.index+1] = (c.registers[o.in.x] / 10) % 10
-	c.memory[c.index+2] = (c.registers[o.in.x]) % 10
+	c.write(c.index, (c.registers[o.in.x]/100)%10)
+	c.write(c.index+1, (c.registers[o.in.x]/10)%10)
+	c.write(c.index+2, (c.registers[o.in.x])%10)
+}
+
+func (o opFX33) String() string {
+	return fmt.Sprintf("LD B, V%X", o.in.x)
+}
+
+// opFX3A sets the audio pattern pitch to Vx (XO-CHIP).
+type opFX3A struct {
+	in *instructionInput
+}
+
+func (o opFX3A) run(c *Emulator) {
+	if !c.xochipOnly() {
+		return
+	}
+	c.pattern.Pitch = c.registers[o.in.x]
+	c.patternDirty = true
+}
+
+func (o opFX3A) String() string {
+	return fmt.Sprintf("PITCH V%X", o.in.x)
 }
 
 // opFX55 copies the values of V0 through Vx into memory, starting at the address in I.
@@ -493,10 +979,15 @@ type opFX55 struct {
 
 func (o opFX55) run(c *Emulator) {
 	for i := uint8(0); i <= o.in.x; i++ {
-		c.memory[c.index+uint16(i)] = c.registers[i]
+		c.write(c.index+uint16(i), c.registers[i])
+	}
+	if c.quirks.Memory {
+		c.index += uint16(o.in.x) + 1
 	}
-	// Super Chip8 behavior: increment I by x+1
-	c.index += uint16(o.in.x) + 1
+}
+
+func (o opFX55) String() string {
+	return fmt.Sprintf("LD [I], V%X", o.in.x)
 }
 
 // opFX65 copies memory into registers V0 through Vx.
@@ -506,8 +997,43 @@ type opFX65 struct {
 
 func (o opFX65) run(c *Emulator) {
 	for i := uint8(0); i <= o.in.x; i++ {
-		c.registers[i] = c.memory[c.index+uint16(i)]
+		c.registers[i] = c.read(c.index + uint16(i))
 	}
-	// Super Chip8 behavior: increment I by x+1
-	c.index += uint16(o.in.x) + 1
+	if c.quirks.Memory {
+		c.index += uint16(o.in.x) + 1
+	}
+}
+
+func (o opFX65) String() string {
+	return fmt.Sprintf("LD V%X, [I]", o.in.x)
+}
+
+// opFX75 stores V0 through Vx in the RPL user flags (SUPER-CHIP).
+type opFX75 struct {
+	in *instructionInput
+}
+
+func (o opFX75) run(c *Emulator) {
+	for i := uint8(0); i <= o.in.x; i++ {
+		c.rplFlags[i] = c.registers[i]
+	}
+}
+
+func (o opFX75) String() string {
+	return fmt.Sprintf("LD R, V%X", o.in.x)
+}
+
+// opFX85 reads V0 through Vx from the RPL user flags (SUPER-CHIP).
+type opFX85 struct {
+	in *instructionInput
+}
+
+func (o opFX85) run(c *Emulator) {
+	for i := uint8(0); i <= o.in.x; i++ {
+		c.registers[i] = c.rplFlags[i]
+	}
+}
+
+func (o opFX85) String() string {
+	return fmt.Sprintf("LD V%X, R", o.in.x)
 }
@@ -0,0 +1,98 @@
+package emulator
+
+import "fmt"
+
+// Platform is the CHIP-8 implementation whose semantics are emulated.
+type Platform string
+
+const (
+	VIP         Platform = "vip"
+	SCHIPLegacy Platform = "schip-legacy"
+	SCHIPModern Platform = "schip-modern"
+	XOCHIP      Platform = "xochip"
+	// ETI660 is the CHIP-8 of the ETI-660 computer, loading programs at 0x600.
+	ETI660 Platform = "eti660"
+)
+
+// Platforms lists the supported platforms.
+var Platforms = []Platform{VIP, SCHIPLegacy, SCHIPModern, XOCHIP, ETI660}
+
+// ParsePlatform returns the platform with the given name.
+func ParsePlatform(name string) (Platform, error) {
+	for _, p := range Platforms {
+		if string(p) == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown platform: %s", name)
+}
+
+// LoadAddress returns the address programs are loaded at and start from.
+func (p Platform) LoadAddress() uint16 {
+	if p == ETI660 {
+		return 0x600
+	}
+	return 0x200
+}
+
+// MemorySize returns the amount of memory addressable on the platform.
+func (p Platform) MemorySize() int {
+	if p == XOCHIP {
+		return 0x10000
+	}
+	return 0x1000
+}
+
+// Quirks returns the default quirks of the platform.
+func (p Platform) Quirks() Quirks {
+	switch p {
+	case SCHIPLegacy:
+		return Quirks{
+			Shifting:      true,
+			Jumping:       true,
+			Clipping:      true,
+			HalfScroll:    true,
+			CollisionRows: true,
+		}
+	case SCHIPModern:
+		return Quirks{
+			Shifting: true,
+			Jumping:  true,
+			Clipping: true,
+		}
+	case XOCHIP:
+		return Quirks{
+			Memory: true,
+		}
+	default:
+		return Quirks{
+			VFReset:     true,
+			Memory:      true,
+			Clipping:    true,
+			DisplayWait: true,
+		}
+	}
+}
+
+// Quirks are the behaviours that differ between CHIP-8 implementations.
+type Quirks struct {
+	// VFReset resets VF to 0 after 8XY1, 8XY2 and 8XY3.
+	VFReset bool
+	// Memory increments I by X+1 after FX55 and FX65.
+	Memory bool
+	// Shifting makes 8XY6 and 8XYE shift Vx in place, ignoring Vy.
+	Shifting bool
+	// Jumping makes BNNN jump to XNN + Vx instead of NNN + V0.
+	Jumping bool
+	// Clipping clips sprites at the screen edges instead of wrapping them around.
+	Clipping bool
+	// HalfScroll scrolls by half the distance in low resolution mode, as
+	// SUPER-CHIP 1.1 always scrolls by high resolution pixels.
+	HalfScroll bool
+	// CollisionRows sets VF to the number of sprite rows that collided or were
+	// clipped in high resolution mode, as in SUPER-CHIP 1.1.
+	CollisionRows bool
+	// DisplayWait makes DXYN wait for the next 60Hz frame, as the COSMAC VIP
+	// waits for the vertical blank interrupt, limiting draws to 60 per second.
+	DisplayWait bool
+}
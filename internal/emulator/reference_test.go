@@ -0,0 +1,266 @@
+package emulator
+
+// reference is a deliberately simple CHIP-8 interpreter, written from the
+// specification without sharing any code with the emulator, that the
+// emulator is checked against. It only covers the low resolution CHIP-8
+// instructions and the quirks affecting them.
+type reference struct {
+	quirks Quirks
+	xochip bool
+
+	mem    [0x10000]uint8
+	v      [16]uint8
+	i      uint16
+	pc     uint16
+	stack  []uint16
+	dt, st uint8
+	screen [64][32]bool
+	keys   [16]bool
+}
+
+func newReference(platform Platform, rom []byte) *reference {
+	r := &reference{quirks: platform.Quirks(), xochip: platform == XOCHIP, pc: 0x200}
+	copy(r.mem[0x000:], font[:])
+	copy(r.mem[0x050:], bigFont[:])
+	copy(r.mem[0x200:], rom)
+	return r
+}
+
+func (r *reference) opcode(addr uint16) uint16 {
+	return uint16(r.mem[addr])<<8 | uint16(r.mem[addr+1])
+}
+
+// modelled reports whether the reference can run the next instruction. Random
+// programs can end up elsewhere, e.g. by overwriting themselves.
+func (r *reference) modelled() bool {
+	op := r.opcode(r.pc)
+	x := op >> 8 & 0xF
+	n := op & 0xF
+	nn := uint8(op)
+
+	switch op >> 12 {
+	case 0x0:
+		return op == 0x00E0 || op == 0x00EE && len(r.stack) > 0
+	case 0x2:
+		return len(r.stack) < 16
+	case 0x3, 0x4, 0x5, 0x9:
+		// XO-CHIP skips the 4 bytes long F000 NNNN as a whole
+		if r.xochip && r.opcode(r.pc+2) == 0xF000 {
+			return false
+		}
+		return op>>12 == 0x3 || op>>12 == 0x4 || n == 0
+	case 0x8:
+		return n <= 0x7 || n == 0xE
+	case 0xC:
+		return false
+	case 0xD:
+		return n != 0
+	case 0xE:
+		if r.xochip && r.opcode(r.pc+2) == 0xF000 {
+			return false
+		}
+		return (nn == 0x9E || nn == 0xA1) && r.v[x] < 16
+	case 0xF:
+		switch nn {
+		case 0x07, 0x15, 0x18, 0x1E, 0x29, 0x33, 0x55, 0x65:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (r *reference) step() {
+	op := r.opcode(r.pc)
+	r.pc += 2
+
+	x := op >> 8 & 0xF
+	y := op >> 4 & 0xF
+	n := op & 0xF
+	nn := uint8(op)
+	nnn := op & 0xFFF
+
+	switch op >> 12 {
+	case 0x0:
+		switch op {
+		case 0x00E0:
+			r.screen = [64][32]bool{}
+		case 0x00EE:
+			r.pc = r.stack[len(r.stack)-1]
+			r.stack = r.stack[:len(r.stack)-1]
+		}
+	case 0x1:
+		r.pc = nnn
+	case 0x2:
+		r.stack = append(r.stack, r.pc)
+		r.pc = nnn
+	case 0x3:
+		if r.v[x] == nn {
+			r.pc += 2
+		}
+	case 0x4:
+		if r.v[x] != nn {
+			r.pc += 2
+		}
+	case 0x5:
+		if r.v[x] == r.v[y] {
+			r.pc += 2
+		}
+	case 0x6:
+		r.v[x] = nn
+	case 0x7:
+		r.v[x] += nn
+	case 0x8:
+		r.alu(x, y, n)
+	case 0x9:
+		if r.v[x] != r.v[y] {
+			r.pc += 2
+		}
+	case 0xA:
+		r.i = nnn
+	case 0xB:
+		if r.quirks.Jumping {
+			r.pc = nnn + uint16(r.v[x])
+		} else {
+			r.pc = nnn + uint16(r.v[0])
+		}
+	case 0xD:
+		r.draw(x, y, n)
+	case 0xE:
+		switch nn {
+		case 0x9E:
+			if r.keys[r.v[x]] {
+				r.pc += 2
+			}
+		case 0xA1:
+			if !r.keys[r.v[x]] {
+				r.pc += 2
+			}
+		}
+	case 0xF:
+		r.misc(x, nn)
+	}
+}
+
+func (r *reference) alu(x, y, n uint16) {
+	vx, vy := r.v[x], r.v[y]
+
+	var result, flag uint8
+	setsFlag := true
+	switch n {
+	case 0x0:
+		result, setsFlag = vy, false
+	case 0x1, 0x2, 0x3:
+		switch n {
+		case 0x1:
+			result = vx | vy
+		case 0x2:
+			result = vx & vy
+		case 0x3:
+			result = vx ^ vy
+		}
+		// the VF reset quirk clears VF, otherwise it's left alone
+		setsFlag = r.quirks.VFReset
+	case 0x4:
+		result = vx + vy
+		if int(vx)+int(vy) > 255 {
+			flag = 1
+		}
+	case 0x5:
+		result = vx - vy
+		if vx >= vy {
+			flag = 1
+		}
+	case 0x7:
+		result = vy - vx
+		if vy >= vx {
+			flag = 1
+		}
+	case 0x6, 0xE:
+		src := vy
+		if r.quirks.Shifting {
+			src = vx
+		}
+		if n == 0x6 {
+			result, flag = src>>1, src&1
+		} else {
+			result, flag = src<<1, src>>7
+		}
+	default:
+		return
+	}
+
+	// the flag is written last, winning over the result when x is F
+	r.v[x] = result
+	if setsFlag {
+		r.v[0xF] = flag
+	}
+}
+
+func (r *reference) draw(x, y, n uint16) {
+	x0 := int(r.v[x]) % 64
+	y0 := int(r.v[y]) % 32
+
+	var collision uint8
+	for row := range int(n) {
+		py := y0 + row
+		if py >= 32 {
+			if r.quirks.Clipping {
+				continue
+			}
+			py %= 32
+		}
+
+		bits := r.mem[r.i+uint16(row)]
+		for col := range 8 {
+			if bits&(0x80>>col) == 0 {
+				continue
+			}
+			px := x0 + col
+			if px >= 64 {
+				if r.quirks.Clipping {
+					continue
+				}
+				px %= 64
+			}
+			if r.screen[px][py] {
+				collision = 1
+			}
+			r.screen[px][py] = !r.screen[px][py]
+		}
+	}
+	r.v[0xF] = collision
+}
+
+func (r *reference) misc(x uint16, nn uint8) {
+	switch nn {
+	case 0x07:
+		r.v[x] = r.dt
+	case 0x15:
+		r.dt = r.v[x]
+	case 0x18:
+		r.st = r.v[x]
+	case 0x1E:
+		r.i += uint16(r.v[x])
+	case 0x29:
+		r.i = uint16(r.v[x]&0xF) * 5
+	case 0x33:
+		r.mem[r.i] = r.v[x] / 100
+		r.mem[r.i+1] = r.v[x] / 10 % 10
+		r.mem[r.i+2] = r.v[x] % 10
+	case 0x55:
+		for j := uint16(0); j <= x; j++ {
+			r.mem[r.i+j] = r.v[j]
+		}
+		if r.quirks.Memory {
+			r.i += x + 1
+		}
+	case 0x65:
+		for j := uint16(0); j <= x; j++ {
+			r.v[j] = r.mem[r.i+j]
+		}
+		if r.quirks.Memory {
+			r.i += x + 1
+		}
+	}
+}
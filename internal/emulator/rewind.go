@@ -0,0 +1,94 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// rewindBuffer is a ring buffer of the states of the last frames.
+//
+// Only the most recent state is kept in full, every older frame is stored
+// as a delta holding the bytes that changed since the frame after it.
+type rewindBuffer struct {
+	last   []byte
+	cur    bytes.Buffer
+	deltas [][]byte
+	head   int // index of the next delta to write
+	size   int
+}
+
+func newRewindBuffer(frames int) *rewindBuffer {
+	return &rewindBuffer{
+		deltas: make([][]byte, frames),
+	}
+}
+
+// capture stores the current state of the emulator.
+func (r *rewindBuffer) capture(c *Emulator) {
+	r.cur.Reset()
+	err := c.SaveState(&r.cur)
+	if err != nil {
+		return
+	}
+	state := r.cur.Bytes()
+
+	if len(r.last) == len(state) {
+		r.deltas[r.head] = diff(state, r.last)
+		r.head = (r.head + 1) % len(r.deltas)
+		r.size = min(r.size+1, len(r.deltas))
+	}
+
+	r.last = append(r.last[:0], state...)
+}
+
+// rewind restores the state of the previous frame, returning false if
+// there's nothing left to rewind.
+func (r *rewindBuffer) rewind(c *Emulator) bool {
+	if r.size == 0 {
+		return false
+	}
+
+	r.head = (r.head - 1 + len(r.deltas)) % len(r.deltas)
+	r.size--
+	patch(r.last, r.deltas[r.head])
+	r.deltas[r.head] = nil
+
+	return c.LoadState(bytes.NewReader(r.last)) == nil
+}
+
+// diff encodes the runs of bytes of to that differ from from, as a sequence
+// of (gap, length, bytes) with the gap from the end of the previous run.
+func diff(from, to []byte) []byte {
+	var delta []byte
+	end := 0
+	for i := 0; i < len(from); {
+		if from[i] == to[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(from) && from[i] != to[i] {
+			i++
+		}
+		delta = binary.AppendUvarint(delta, uint64(start-end))
+		delta = binary.AppendUvarint(delta, uint64(i-start))
+		delta = append(delta, to[start:i]...)
+		end = i
+	}
+	return delta
+}
+
+// patch applies a delta created by diff.
+func patch(state, delta []byte) {
+	end := 0
+	for len(delta) > 0 {
+		gap, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		length, n := binary.Uvarint(delta)
+		delta = delta[n:]
+
+		start := end + int(gap)
+		end = start + copy(state[start:start+int(length)], delta[:length])
+		delta = delta[length:]
+	}
+}
@@ -0,0 +1,121 @@
+package emulator
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/ruggi/c8/internal/display"
+)
+
+// mutate changes a few parts of the machine state, as a frame would.
+func mutate(c *Emulator, rnd *rand.Rand) {
+	for range rnd.Intn(300) {
+		c.memory[rnd.Intn(len(c.memory))] = uint8(rnd.Intn(0x100))
+	}
+	// a run longer than a single byte uvarint
+	if rnd.Intn(4) == 0 {
+		start := rnd.Intn(len(c.memory) - 1000)
+		rnd.Read(c.memory[start : start+200+rnd.Intn(800)])
+	}
+	c.registers[rnd.Intn(16)]++
+	c.pc += 2
+	c.index = uint16(rnd.Intn(0x10000))
+	if c.delayTimer > 0 {
+		c.delayTimer--
+	}
+	c.fb.Pixels[rnd.Intn(display.HiResWidth)][rnd.Intn(display.HiResHeight)] ^= 1
+	c.halted = rnd.Intn(10) == 0
+}
+
+func TestRewind(t *testing.T) {
+	const (
+		size   = 8
+		frames = 30
+	)
+
+	rnd := rand.New(rand.NewSource(1))
+	c := randomState(rnd)
+	r := newRewindBuffer(size)
+
+	var states [][]byte
+	for range frames {
+		mutate(c, rnd)
+		r.capture(c)
+		states = append(states, save(t, c))
+	}
+
+	// the buffer wrapped around, only the last size frames are left
+	for i := range size {
+		if !r.rewind(c) {
+			t.Fatalf("rewind %d: nothing left", i+1)
+		}
+		want := states[frames-2-i]
+		if !bytes.Equal(save(t, c), want) {
+			t.Fatalf("rewind %d: state differs from frame %d", i+1, frames-2-i)
+		}
+	}
+
+	before := save(t, c)
+	if r.rewind(c) {
+		t.Fatal("rewound past the size of the buffer")
+	}
+	if !bytes.Equal(save(t, c), before) {
+		t.Fatal("state changed with nothing left to rewind")
+	}
+
+	// capturing again after rewinding carries on from the rewound state
+	mutate(c, rnd)
+	r.capture(c)
+	if !r.rewind(c) || !bytes.Equal(save(t, c), before) {
+		t.Fatal("rewind after capturing again doesn't go back to the rewound state")
+	}
+}
+
+func TestDiffPatch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	from := make([]byte, 5000)
+	rnd.Read(from)
+
+	tests := []struct {
+		name string
+		edit func(b []byte)
+	}{
+		{"same", func(b []byte) {}},
+		{"first byte", func(b []byte) { b[0]++ }},
+		{"last byte", func(b []byte) { b[len(b)-1]++ }},
+		{"long gap", func(b []byte) { b[4000]++ }},
+		{"long run", func(b []byte) {
+			for i := 100; i < 400; i++ {
+				b[i]++
+			}
+		}},
+		{"scattered", func(b []byte) {
+			for i := 0; i < len(b); i += 1 + rnd.Intn(200) {
+				b[i]++
+			}
+		}},
+		{"everything", func(b []byte) {
+			for i := range b {
+				b[i]++
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to := bytes.Clone(from)
+			tt.edit(to)
+
+			delta := diff(from, to)
+			if bytes.Equal(from, to) && len(delta) != 0 {
+				t.Fatalf("delta of %d bytes between equal states", len(delta))
+			}
+
+			got := bytes.Clone(from)
+			patch(got, delta)
+			if !bytes.Equal(got, to) {
+				t.Fatal("patched state differs")
+			}
+		})
+	}
+}
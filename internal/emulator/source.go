@@ -0,0 +1,81 @@
+package emulator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxStatementSize is the longest a single source statement assembles to,
+// e.g. the comparisons going through vf.
+const maxStatementSize = 8
+
+// Source maps the loaded ROM back to the source it was assembled from, for
+// source-level debugging.
+type Source struct {
+	// Lines are the lines of the source file.
+	Lines []string
+	// Map maps the address of the first byte of each statement to its 1-based line.
+	Map map[uint16]int
+	// Labels names addresses.
+	Labels map[uint16]string
+}
+
+// line returns the source line of the statement containing addr, or 0.
+func (s *Source) line(addr uint16) int {
+	for a := int(addr); a >= 0 && a > int(addr)-maxStatementSize; a-- {
+		if l, ok := s.Map[uint16(a)]; ok {
+			return l
+		}
+	}
+	return 0
+}
+
+// symbol names addr relative to the closest label before it, e.g. draw+4.
+func (s *Source) symbol(addr uint16) string {
+	name, at := "", uint16(0)
+	for a, l := range s.Labels {
+		if a <= addr && (name == "" || a > at || a == at && l < name) {
+			name, at = l, a
+		}
+	}
+	switch {
+	case name == "":
+		return fmt.Sprintf("%04X", addr)
+	case at == addr:
+		return name
+	}
+	return fmt.Sprintf("%s+%d", name, addr-at)
+}
+
+// breakpointLines returns the source lines with a breakpoint.
+func (s *Source) breakpointLines(breakpoints map[uint16]bool) map[int]bool {
+	lines := map[int]bool{}
+	for addr := range breakpoints {
+		if l := s.line(addr); l != 0 {
+			lines[l] = true
+		}
+	}
+	return lines
+}
+
+// listing returns n source lines around the one at pc, marking it and the
+// lines with breakpoints.
+func (s *Source) listing(pc uint16, breakpoints map[uint16]bool, n int) []string {
+	current := s.line(pc)
+	marked := s.breakpointLines(breakpoints)
+
+	first := max(current-n/3, 1)
+	var lines []string
+	for l := first; l < first+n && l <= len(s.Lines); l++ {
+		marker := "  "
+		if l == current {
+			marker = "> "
+		}
+		if marked[l] {
+			marker = marker[:1] + "*"
+		}
+		text := strings.ReplaceAll(s.Lines[l-1], "\t", "  ")
+		lines = append(lines, fmt.Sprintf("%s%4d  %s", marker, l, text))
+	}
+	return lines
+}
@@ -0,0 +1,124 @@
+package emulator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ruggi/c8/internal/assembler"
+)
+
+const sourceProgram = `: main
+	v0 := 1
+	if v0 < 5 then
+		clear
+	loop
+		draw
+	again
+: draw
+	i := sprite
+	sprite v0 v0 2
+	return
+: sprite
+	0xFF 0x81
+	0x81 0xFF`
+
+// assembleSource assembles src, mapping it back the way main does.
+func assembleSource(t *testing.T, src string) (*assembler.Program, *Source) {
+	t.Helper()
+
+	prog, err := assembler.Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Source{Lines: strings.Split(src, "\n"), Map: prog.Lines, Labels: map[uint16]string{}}
+	for name, addr := range prog.Labels {
+		s.Labels[addr] = name
+	}
+	return prog, s
+}
+
+func TestSourceLines(t *testing.T) {
+	prog, s := assembleSource(t, sourceProgram)
+
+	tests := []struct {
+		addr   uint16
+		line   int
+		symbol string
+	}{
+		{0x200, 2, "main"},
+		{0x202, 3, "main+2"},
+		{0x206, 3, "main+6"}, // inside the comparison through vf
+		{0x208, 4, "main+8"},
+		{0x20A, 6, "main+10"},
+		{0x20C, 7, "main+12"},
+		{0x20E, 9, "draw"},
+		{0x210, 10, "draw+2"},
+		{0x212, 11, "draw+4"},
+		{0x214, 13, "sprite"},
+		{0x215, 13, "sprite+1"}, // inside data
+		{0x217, 14, "sprite+3"},
+		{0x100, 0, "0100"},
+		{0x300, 0, "sprite+236"},
+	}
+	for _, tt := range tests {
+		if got := s.line(tt.addr); got != tt.line {
+			t.Errorf("line of %04X: got %d, want %d", tt.addr, got, tt.line)
+		}
+		if got := s.symbol(tt.addr); got != tt.symbol {
+			t.Errorf("symbol of %04X: got %q, want %q", tt.addr, got, tt.symbol)
+		}
+	}
+
+	lines := []struct {
+		line int
+		addr uint16
+		ok   bool
+	}{
+		{1, 0x200, true}, // a label, before the first statement
+		{3, 0x202, true},
+		{5, 0x20A, true}, // loop, at its first statement
+		{8, 0x20E, true},
+		{12, 0x214, true},
+		{14, 0x216, true},
+		{15, 0, false},
+	}
+	for _, tt := range lines {
+		if addr, ok := prog.LineAddr(tt.line); addr != tt.addr || ok != tt.ok {
+			t.Errorf("address of line %d: got %04X, %v, want %04X, %v", tt.line, addr, ok, tt.addr, tt.ok)
+		}
+	}
+
+	// every address of a line maps back to it
+	for addr, line := range prog.Lines {
+		if got := s.line(addr); got != line {
+			t.Errorf("line of %04X: got %d, want %d", addr, got, line)
+		}
+	}
+}
+
+func TestSourceListing(t *testing.T) {
+	_, s := assembleSource(t, sourceProgram)
+
+	got := s.listing(0x210, map[uint16]bool{0x20E: true, 0x215: true}, 5)
+	want := []string{
+		" *   9    i := sprite",
+		">   10    sprite v0 v0 2",
+		"    11    return",
+		"    12  : sprite",
+		" *  13    0xFF 0x81",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// near the start, the listing doesn't go before the first line
+	got = s.listing(0x200, nil, 3)
+	want = []string{
+		"     1  : main",
+		">    2    v0 := 1",
+		"     3    if v0 < 5 then",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,189 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ruggi/c8/internal/display"
+	"github.com/ruggi/c8/internal/input"
+)
+
+// Save states are made of a header, the machine state and the memory.
+// Bump stateVersion whenever machineState changes.
+const (
+	stateMagic   = "C8ST"
+	stateVersion = 1
+)
+
+var ErrInvalidState = errors.New("invalid save state")
+
+type stateHeader struct {
+	Magic      [4]byte
+	Version    uint16
+	MemorySize uint32
+}
+
+type machineState struct {
+	PC        uint16
+	Stack     [16]uint16
+	SP        uint8
+	Registers [16]uint8
+	Index     uint16
+
+	DelayTimer uint8
+	SoundTimer uint8
+
+	HiRes  bool
+	Pixels [display.HiResWidth][display.HiResHeight]uint8
+	Planes uint8
+
+	WaitingForKey bool
+	KeyWaitTarget uint8
+
+	RPLFlags [16]uint8
+	Halted   bool
+
+	Pattern [16]uint8
+	Pitch   uint8
+}
+
+// SaveState writes the full machine state to w.
+func (c *Emulator) SaveState(w io.Writer) error {
+	header := stateHeader{
+		Version:    stateVersion,
+		MemorySize: uint32(len(c.memory)),
+	}
+	copy(header.Magic[:], stateMagic)
+
+	ms := machineState{
+		PC:            c.pc,
+		Stack:         c.stack,
+		SP:            c.sp,
+		Registers:     c.registers,
+		Index:         c.index,
+		DelayTimer:    c.delayTimer,
+		SoundTimer:    c.soundTimer,
+		HiRes:         c.fb.HiRes,
+		Pixels:        c.fb.Pixels,
+		Planes:        c.planes,
+		WaitingForKey: c.waitingForKey,
+		KeyWaitTarget: c.keyWaitTarget,
+		RPLFlags:      c.rplFlags,
+		Halted:        c.halted,
+		Pattern:       c.pattern.Buffer,
+		Pitch:         c.pattern.Pitch,
+	}
+
+	for _, v := range []any{header, ms} {
+		err := binary.Write(w, binary.LittleEndian, v)
+		if err != nil {
+			return fmt.Errorf("write state: %w", err)
+		}
+	}
+	_, err := w.Write(c.memory[:])
+	if err != nil {
+		return fmt.Errorf("write memory: %w", err)
+	}
+
+	return nil
+}
+
+// LoadState restores the machine state previously written by SaveState.
+func (c *Emulator) LoadState(r io.Reader) error {
+	var header stateHeader
+	err := readState(r, &header, "header")
+	if err != nil {
+		return err
+	}
+	if string(header.Magic[:]) != stateMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidState)
+	}
+	if header.Version != stateVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidState, header.Version)
+	}
+	if int(header.MemorySize) != len(c.memory) {
+		return fmt.Errorf("%w: unexpected memory size %d", ErrInvalidState, header.MemorySize)
+	}
+
+	var ms machineState
+	err = readState(r, &ms, "state")
+	if err != nil {
+		return err
+	}
+	if int(ms.SP) > len(c.stack) {
+		return fmt.Errorf("%w: stack pointer %d out of range", ErrInvalidState, ms.SP)
+	}
+	if int(ms.KeyWaitTarget) >= len(input.KeysMap{}) {
+		return fmt.Errorf("%w: key %d out of range", ErrInvalidState, ms.KeyWaitTarget)
+	}
+	var memory [0x10000]uint8
+	err = readState(r, &memory, "memory")
+	if err != nil {
+		return err
+	}
+
+	c.memory = memory
+	c.pc = ms.PC
+	c.stack = ms.Stack
+	c.sp = ms.SP
+	c.registers = ms.Registers
+	c.index = ms.Index
+	c.delayTimer = ms.DelayTimer
+	c.soundTimer = ms.SoundTimer
+	c.fb = display.Framebuffer{HiRes: ms.HiRes, Pixels: ms.Pixels}
+	c.planes = ms.Planes
+	c.waitingForKey = ms.WaitingForKey
+	c.keyWaitTarget = ms.KeyWaitTarget
+	c.rplFlags = ms.RPLFlags
+	c.halted = ms.Halted
+	c.pattern.Buffer = ms.Pattern
+	c.pattern.Pitch = ms.Pitch
+	c.patternDirty = true
+
+	return nil
+}
+
+// readState reads v, a part of a save state. Reading past the end of r
+// means the state is truncated.
+func readState(r io.Reader, v any, part string) error {
+	err := binary.Read(r, binary.LittleEndian, v)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated %s", ErrInvalidState, part)
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", part, err)
+	}
+	return nil
+}
+
+// stateFile returns the path of the save state file for the given slot.
+func (c *Emulator) stateFile(slot int) string {
+	return fmt.Sprintf("%s.state%d", c.statePath, slot)
+}
+
+func (c *Emulator) saveSlot(slot int) error {
+	f, err := os.Create(c.stateFile(slot))
+	if err != nil {
+		return fmt.Errorf("create state file: %w", err)
+	}
+	defer f.Close()
+
+	err = c.SaveState(f)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (c *Emulator) loadSlot(slot int) error {
+	f, err := os.Open(c.stateFile(slot))
+	if err != nil {
+		return fmt.Errorf("open state file: %w", err)
+	}
+	defer f.Close()
+
+	return c.LoadState(f)
+}
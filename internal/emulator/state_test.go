@@ -0,0 +1,169 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ruggi/c8/internal/backend/headless"
+	"github.com/ruggi/c8/internal/input"
+)
+
+// randomState returns an emulator with every part of the machine state set.
+func randomState(rnd *rand.Rand) *Emulator {
+	var k keypad
+	c := New(&k, Options{Platform: XOCHIP, Quirks: XOCHIP.Quirks()})
+	rnd.Read(c.memory[:])
+	c.pc = uint16(rnd.Intn(0x10000))
+	for i := range c.stack {
+		c.stack[i] = uint16(rnd.Intn(0x10000))
+	}
+	c.sp = uint8(rnd.Intn(len(c.stack) + 1))
+	rnd.Read(c.registers[:])
+	c.index = uint16(rnd.Intn(0x10000))
+	c.delayTimer = uint8(rnd.Intn(0x100))
+	c.soundTimer = uint8(rnd.Intn(0x100))
+	c.fb.HiRes = rnd.Intn(2) == 1
+	for x := range c.fb.Pixels {
+		for y := range c.fb.Pixels[x] {
+			c.fb.Pixels[x][y] = uint8(rnd.Intn(4))
+		}
+	}
+	c.planes = uint8(rnd.Intn(4))
+	c.waitingForKey = rnd.Intn(2) == 1
+	c.keyWaitTarget = uint8(rnd.Intn(16))
+	rnd.Read(c.rplFlags[:])
+	c.halted = rnd.Intn(2) == 1
+	rnd.Read(c.pattern.Buffer[:])
+	c.pattern.Pitch = uint8(rnd.Intn(0x100))
+	return c
+}
+
+func save(t *testing.T, c *Emulator) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := c.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for range 20 {
+		want := randomState(rnd)
+		data := save(t, want)
+
+		var k keypad
+		got := New(&k, Options{Platform: XOCHIP})
+		if err := got.LoadState(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.memory != want.memory || got.fb != want.fb ||
+			got.pc != want.pc || got.stack != want.stack || got.sp != want.sp ||
+			got.registers != want.registers || got.index != want.index ||
+			got.delayTimer != want.delayTimer || got.soundTimer != want.soundTimer ||
+			got.planes != want.planes || got.rplFlags != want.rplFlags || got.halted != want.halted ||
+			got.waitingForKey != want.waitingForKey || got.keyWaitTarget != want.keyWaitTarget ||
+			got.pattern != want.pattern {
+			t.Fatal("loaded state differs from the saved one")
+		}
+		if !got.patternDirty {
+			t.Fatal("pattern not marked to be set on the backend")
+		}
+		if !bytes.Equal(save(t, got), data) {
+			t.Fatal("saving the loaded state gives different bytes")
+		}
+	}
+}
+
+func TestLoadInvalidState(t *testing.T) {
+	var k keypad
+	data := save(t, New(&k, Options{}))
+
+	// encode writes a valid state changed by edit
+	encode := func(edit func(h *stateHeader, ms *machineState)) []byte {
+		h := stateHeader{Version: stateVersion, MemorySize: 0x10000}
+		copy(h.Magic[:], stateMagic)
+		var ms machineState
+		edit(&h, &ms)
+
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, h)
+		binary.Write(&buf, binary.LittleEndian, ms)
+		buf.Write(make([]byte, h.MemorySize))
+		return buf.Bytes()
+	}
+	header := binary.Size(stateHeader{})
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "truncated header"},
+		{"short header", data[:header-1], "truncated header"},
+		{"short state", data[:header+100], "truncated state"},
+		{"short memory", data[:len(data)-1], "truncated memory"},
+		{"magic", encode(func(h *stateHeader, ms *machineState) { h.Magic[0] = 'X' }), "bad magic"},
+		{"version", encode(func(h *stateHeader, ms *machineState) { h.Version++ }), "unsupported version"},
+		{"memory size", encode(func(h *stateHeader, ms *machineState) { h.MemorySize = 0x1000 }), "unexpected memory size"},
+		{"stack pointer", encode(func(h *stateHeader, ms *machineState) { ms.SP = 17 }), "stack pointer 17 out of range"},
+		{"key", encode(func(h *stateHeader, ms *machineState) { ms.KeyWaitTarget = 16 }), "key 16 out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(&k, Options{})
+			c.registers[0] = 0xAB
+
+			err := c.LoadState(bytes.NewReader(tt.data))
+			if !errors.Is(err, ErrInvalidState) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want %s: %s", err, ErrInvalidState, tt.want)
+			}
+			if c.registers[0] != 0xAB {
+				t.Fatal("state changed by a failed load")
+			}
+		})
+	}
+}
+
+func TestStateSlotsStatus(t *testing.T) {
+	b, _ := headless.New("test")
+	rom := []byte{0x12, 0x00}
+	c := New(b, Options{StatePath: filepath.Join(t.TempDir(), "missing", "rom")})
+	if err := c.Load(rom); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := func(cmd input.Command, want string) {
+		t.Helper()
+		b.Command(cmd)
+		if err := c.RunFrames(b, 1, 1); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.Status(); !strings.HasPrefix(got, want) {
+			t.Fatalf("status %q, want %q", got, want)
+		}
+	}
+
+	frame(input.SaveState, "save state 1: create state file")
+	frame(input.LoadState, "load state 1: open state file")
+
+	c.statePath = filepath.Join(t.TempDir(), "rom")
+	frame(input.NextSlot, "state slot 2")
+	frame(input.SaveState, "saved state 2")
+	frame(input.LoadState, "loaded state 2")
+
+	if err := c.RunFrames(b, statusFrames, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Status(); got != "" {
+		t.Fatalf("status %q not cleared", got)
+	}
+}
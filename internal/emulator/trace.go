@@ -0,0 +1,133 @@
+package emulator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// TraceFormat is the format of the instruction trace.
+type TraceFormat string
+
+const (
+	// TraceText writes a line per instruction: PC, opcode, mnemonic, I and
+	// the registers it changed, e.g. "0211 7103     ADD V1, 0x03       I=0202 V1=0D".
+	TraceText TraceFormat = "text"
+	// TraceBinary writes the "C8TR" magic, followed by a record per
+	// instruction: PC, opcode, I and a bitmask of the changed registers as
+	// little endian uint16s, then the new value of each changed register.
+	TraceBinary TraceFormat = "binary"
+)
+
+const traceMagic = "C8TR"
+
+// tracer writes a record for every executed instruction.
+type tracer struct {
+	w      *bufio.Writer
+	format TraceFormat
+	err    error
+
+	// state before the instruction, decoded before it runs as it can
+	// overwrite itself
+	pc        uint16
+	opcode    uint16
+	text      string
+	registers [16]uint8
+}
+
+func newTracer(w io.Writer, format TraceFormat) *tracer {
+	t := &tracer{
+		w:      bufio.NewWriter(w),
+		format: format,
+	}
+	if format == TraceBinary {
+		t.w.WriteString(traceMagic)
+	}
+	return t
+}
+
+// before records the state before the instruction at pc runs.
+func (t *tracer) before(c *Emulator) {
+	t.pc = c.pc
+	t.opcode = c.opcodeAt(c.pc)
+	if t.format == TraceText {
+		ins := Decode(c.memory[:], c.pc, c.platform)
+		t.text = fmt.Sprintf("%04X %-8X %-18s", t.pc, ins.Bytes, ins.Format(Classic, nil))
+	}
+	t.registers = c.registers
+}
+
+// after writes the record of the instruction that just ran.
+func (t *tracer) after(c *Emulator) {
+	if t.err != nil {
+		return
+	}
+
+	var changed uint16
+	for i, v := range c.registers {
+		if v != t.registers[i] {
+			changed |= 1 << i
+		}
+	}
+
+	var err error
+	if t.format == TraceBinary {
+		err = t.writeBinary(c, changed)
+	} else {
+		err = t.writeText(c, changed)
+	}
+	if err != nil {
+		t.fail(err)
+	}
+}
+
+func (t *tracer) writeText(c *Emulator, changed uint16) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s I=%04X", t.text, c.index)
+	for i, v := range c.registers {
+		if changed&(1<<i) != 0 {
+			fmt.Fprintf(&b, " V%X=%02X", i, v)
+		}
+	}
+	b.WriteByte('\n')
+
+	_, err := t.w.WriteString(b.String())
+	return err
+}
+
+func (t *tracer) writeBinary(c *Emulator, changed uint16) error {
+	record := make([]byte, 8, 8+16)
+	binary.LittleEndian.PutUint16(record[0:], t.pc)
+	binary.LittleEndian.PutUint16(record[2:], t.opcode)
+	binary.LittleEndian.PutUint16(record[4:], c.index)
+	binary.LittleEndian.PutUint16(record[6:], changed)
+	for i, v := range c.registers {
+		if changed&(1<<i) != 0 {
+			record = append(record, v)
+		}
+	}
+
+	_, err := t.w.Write(record)
+	return err
+}
+
+// flush writes the buffered records, returning the first error of the trace.
+func (t *tracer) flush() error {
+	if t.err != nil {
+		return t.err
+	}
+	err := t.w.Flush()
+	if err != nil {
+		t.fail(err)
+	}
+	return t.err
+}
+
+// fail stops tracing after the first error.
+func (t *tracer) fail(err error) {
+	t.err = fmt.Errorf("trace: %w", err)
+	log.Print(t.err)
+}
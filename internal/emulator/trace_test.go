@@ -0,0 +1,59 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/ruggi/c8/internal/backend/headless"
+)
+
+// traceROM overwrites its third instruction as it runs it, then faults.
+var traceROM = []byte{
+	0xA2, 0x04, // I := 0x204
+	0x60, 0x12, // V0 := 0x12
+	0xF0, 0x55, // save V0, making this 0x1255
+	0xFF, 0xFF, // unknown opcode
+}
+
+func TestTrace(t *testing.T) {
+	var buf bytes.Buffer
+	b, _ := headless.New("test")
+	c := New(b, Options{Trace: &buf, TraceFormat: TraceText})
+	if err := c.Load(traceROM); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunFrames(b, 1, 10); err == nil {
+		t.Fatal("no fault")
+	}
+
+	// flushed when the fault stops the run, before any render
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4:\n%s", len(lines), buf.String())
+	}
+	if want := "0204 F055     LD [I], V0"; !strings.HasPrefix(lines[2], want) {
+		t.Fatalf("got %q, want the instruction as it was before running, %q", lines[2], want)
+	}
+}
+
+func TestTraceBinary(t *testing.T) {
+	var buf bytes.Buffer
+	b, _ := headless.New("test")
+	c := New(b, Options{Trace: &buf, TraceFormat: TraceBinary})
+	if err := c.Load(traceROM); err != nil {
+		t.Fatal(err)
+	}
+	c.RunFrames(b, 1, 10)
+
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte(traceMagic)) {
+		t.Fatalf("missing magic: %X", data)
+	}
+	// I := 0x204 changes no register, V0 := 0x12 changes V0
+	third := data[len(traceMagic)+8+9:]
+	if pc, opcode := binary.LittleEndian.Uint16(third), binary.LittleEndian.Uint16(third[2:]); pc != 0x204 || opcode != 0xF055 {
+		t.Fatalf("got %04X %04X, want 0204 F055", pc, opcode)
+	}
+}
@@ -0,0 +1,158 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Access is a kind of memory access.
+type Access uint8
+
+const (
+	Read Access = 1 << iota
+	Write
+	Exec
+)
+
+func (a Access) String() string {
+	switch a {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case Exec:
+		return "exec"
+	}
+	return fmt.Sprintf("access(%d)", uint8(a))
+}
+
+// Watchpoint breaks into the debugger or logs when memory between Start and
+// End (inclusive) is accessed.
+type Watchpoint struct {
+	Start  uint16
+	End    uint16
+	Access Access
+	Break  bool
+}
+
+// ParseWatchpoint parses a watchpoint in the form <start>[-<end>]:<rwx>[:log],
+// e.g. 0x300-0x30F:w breaks on writes to the 16 bytes at 0x300.
+func ParseWatchpoint(s string) (Watchpoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Watchpoint{}, fmt.Errorf("invalid watchpoint %q, expected <start>[-<end>]:<rwx>[:log]", s)
+	}
+
+	wp := Watchpoint{Break: true}
+
+	start, end, isRange := strings.Cut(parts[0], "-")
+	addr, err := strconv.ParseUint(start, 0, 16)
+	if err != nil {
+		return Watchpoint{}, fmt.Errorf("invalid watchpoint start %q: %w", start, err)
+	}
+	wp.Start, wp.End = uint16(addr), uint16(addr)
+	if isRange {
+		addr, err := strconv.ParseUint(end, 0, 16)
+		if err != nil {
+			return Watchpoint{}, fmt.Errorf("invalid watchpoint end %q: %w", end, err)
+		}
+		wp.End = uint16(addr)
+	}
+	if wp.End < wp.Start {
+		return Watchpoint{}, fmt.Errorf("invalid watchpoint %q, end before start", s)
+	}
+
+	for _, r := range parts[1] {
+		switch r {
+		case 'r':
+			wp.Access |= Read
+		case 'w':
+			wp.Access |= Write
+		case 'x':
+			wp.Access |= Exec
+		default:
+			return Watchpoint{}, fmt.Errorf("invalid watchpoint access %q", r)
+		}
+	}
+	if wp.Access == 0 {
+		return Watchpoint{}, fmt.Errorf("invalid watchpoint %q, missing access", s)
+	}
+
+	if len(parts) == 3 {
+		if parts[2] != "log" {
+			return Watchpoint{}, fmt.Errorf("invalid watchpoint action %q", parts[2])
+		}
+		wp.Break = false
+	}
+
+	return wp, nil
+}
+
+// String returns the watchpoint in the form parsed by ParseWatchpoint.
+func (wp Watchpoint) String() string {
+	s := fmt.Sprintf("0x%X", wp.Start)
+	if wp.End != wp.Start {
+		s += fmt.Sprintf("-0x%X", wp.End)
+	}
+	s += ":"
+	for i, a := range []Access{Read, Write, Exec} {
+		if wp.Access&a != 0 {
+			s += string("rwx"[i])
+		}
+	}
+	if !wp.Break {
+		s += ":log"
+	}
+	return s
+}
+
+func (wp Watchpoint) matches(addr uint16, access Access) bool {
+	return wp.Access&access != 0 && addr >= wp.Start && addr <= wp.End
+}
+
+// read reads memory, triggering the read watchpoints.
+func (c *Emulator) read(addr uint16) uint8 {
+	v := c.memory[addr]
+	if len(c.watchpoints) > 0 {
+		c.watch(addr, Read, v)
+	}
+	return v
+}
+
+// write writes memory, triggering the write watchpoints.
+func (c *Emulator) write(addr uint16, v uint8) {
+	c.memory[addr] = v
+	if len(c.watchpoints) > 0 {
+		c.watch(addr, Write, v)
+	}
+}
+
+// watch logs the access or pauses the debugger for the matching watchpoints.
+func (c *Emulator) watch(addr uint16, access Access, v uint8) {
+	for _, wp := range c.watchpoints {
+		if !wp.matches(addr, access) {
+			continue
+		}
+		if wp.Break {
+			// breaking on exec happens before running the instruction, see execWatchpoint
+			if access != Exec && c.debugger != nil {
+				c.debugger.breakOnWatch(wp, fmt.Sprintf("%s %04X = %02X at %04X", access, addr, v, c.opPC))
+			}
+			continue
+		}
+		if c.watchLog != nil {
+			fmt.Fprintf(c.watchLog, "PC %04X  %-5s %04X = %02X\n", c.opPC, access, addr, v)
+		}
+	}
+}
+
+// execWatchpoint returns the watchpoint breaking before executing addr, if any.
+func (c *Emulator) execWatchpoint(addr uint16) (Watchpoint, bool) {
+	for _, wp := range c.watchpoints {
+		if wp.Break && wp.matches(addr, Exec) {
+			return wp, true
+		}
+	}
+	return Watchpoint{}, false
+}
@@ -2,6 +2,26 @@ package input
 
 type KeysMap [16]bool
 
+// Command is an emulator action bound to a hotkey.
+type Command int
+
+const (
+	SaveState Command = iota + 1
+	LoadState
+	NextSlot
+	PrevSlot
+	// Rewind is sent every frame while the rewind hotkey is held.
+	Rewind
+	TogglePause
+	Step
+	StepOver
+	ToggleBreakpoint
+	// Quit stops the emulator, e.g. when the window is closed.
+	Quit
+)
+
 type Manager interface {
 	GetKeys() KeysMap
+	// Commands returns the commands triggered since the last call.
+	Commands() []Command
 }
@@ -0,0 +1,214 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Keymap maps the keyboard keys and the gamepad buttons to the CHIP-8 keys.
+type Keymap struct {
+	// Keys maps the keyboard keys, named by the lower case character they
+	// type, to CHIP-8 keys.
+	Keys map[rune]uint8
+	// Gamepads map the buttons of each gamepad, in the order they're
+	// connected, to CHIP-8 keys. Without any, every gamepad uses
+	// DefaultGamepad.
+	Gamepads []GamepadMap
+}
+
+// GamepadMap maps the buttons of a gamepad to CHIP-8 keys.
+type GamepadMap map[Button]uint8
+
+// Button is a gamepad button, named after the SDL game controller ones.
+type Button string
+
+const (
+	ButtonA             Button = "a"
+	ButtonB             Button = "b"
+	ButtonX             Button = "x"
+	ButtonY             Button = "y"
+	ButtonBack          Button = "back"
+	ButtonGuide         Button = "guide"
+	ButtonStart         Button = "start"
+	ButtonLeftStick     Button = "leftstick"
+	ButtonRightStick    Button = "rightstick"
+	ButtonLeftShoulder  Button = "leftshoulder"
+	ButtonRightShoulder Button = "rightshoulder"
+	ButtonUp            Button = "dpup"
+	ButtonDown          Button = "dpdown"
+	ButtonLeft          Button = "dpleft"
+	ButtonRight         Button = "dpright"
+)
+
+// Buttons lists the supported gamepad buttons.
+var Buttons = []Button{
+	ButtonA, ButtonB, ButtonX, ButtonY,
+	ButtonBack, ButtonGuide, ButtonStart,
+	ButtonLeftStick, ButtonRightStick, ButtonLeftShoulder, ButtonRightShoulder,
+	ButtonUp, ButtonDown, ButtonLeft, ButtonRight,
+}
+
+// DefaultGamepad maps the D-pad to 2, 8, 4 and 6, which most games move
+// with, and A and B to 5 and 0.
+var DefaultGamepad = GamepadMap{
+	ButtonUp:    0x2,
+	ButtonDown:  0x8,
+	ButtonLeft:  0x4,
+	ButtonRight: 0x6,
+	ButtonA:     0x5,
+	ButtonB:     0x0,
+}
+
+// Key returns the CHIP-8 key mapped to the keyboard key typing r.
+func (k Keymap) Key(r rune) (uint8, bool) {
+	key, ok := k.Keys[unicode.ToLower(r)]
+	return key, ok
+}
+
+// Button returns the CHIP-8 key mapped to the button of the nth gamepad.
+func (k Keymap) Button(gamepad int, b Button) (uint8, bool) {
+	m := DefaultGamepad
+	if len(k.Gamepads) > 0 {
+		if gamepad >= len(k.Gamepads) {
+			return 0, false
+		}
+		m = k.Gamepads[gamepad]
+	}
+	key, ok := m[b]
+	return key, ok
+}
+
+// KeymapPreset is a named keymap.
+type KeymapPreset string
+
+const (
+	// HexKeymap maps 0-9 and A-F to the CHIP-8 keys of the same name.
+	HexKeymap KeymapPreset = "hex"
+	// COSMACKeymap lays the COSMAC VIP hex pad out on the left of the keyboard:
+	//
+	//	1 2 3 4      1 2 3 C
+	//	Q W E R  ->  4 5 6 D
+	//	A S D F      7 8 9 E
+	//	Z X C V      A 0 B F
+	COSMACKeymap KeymapPreset = "cosmac"
+)
+
+// KeymapPresets lists the supported keymap presets.
+var KeymapPresets = []KeymapPreset{HexKeymap, COSMACKeymap}
+
+// ParseKeymapPreset returns the keymap preset with the given name.
+func ParseKeymapPreset(name string) (KeymapPreset, error) {
+	for _, p := range KeymapPresets {
+		if string(p) == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown keymap: %s", name)
+}
+
+// Keymap returns the keymap of the preset.
+func (p KeymapPreset) Keymap() Keymap {
+	layout := "0123456789abcdef"
+	if p == COSMACKeymap {
+		// the keyboard keys of CHIP-8 keys 0 to F
+		layout = "x123qweasdzc4rfv"
+	}
+
+	k := Keymap{Keys: map[rune]uint8{}}
+	for key, r := range layout {
+		k.Keys[r] = uint8(key)
+	}
+	return k
+}
+
+// keymapFile is a keymap as written in a JSON file, e.g.
+//
+//	{
+//		"preset": "cosmac",
+//		"keys": {"space": "5"},
+//		"gamepads": [{"dpup": "1", "dpdown": "4"}, {"dpup": "c", "dpdown": "d"}]
+//	}
+type keymapFile struct {
+	// Preset is the keymap to start from, HexKeymap by default.
+	Preset KeymapPreset `json:"preset"`
+	// Keys maps more keyboard keys, overriding the preset ones, to CHIP-8
+	// keys as hex digits.
+	Keys map[string]string `json:"keys"`
+	// Gamepads map the buttons of each gamepad to CHIP-8 keys as hex digits.
+	Gamepads []map[Button]string `json:"gamepads"`
+}
+
+// LoadKeymap reads a keymap from a JSON file.
+func LoadKeymap(path string) (Keymap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Keymap{}, fmt.Errorf("read keymap: %w", err)
+	}
+
+	var f keymapFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return Keymap{}, fmt.Errorf("parse keymap %s: %w", path, err)
+	}
+
+	preset := HexKeymap
+	if f.Preset != "" {
+		preset, err = ParseKeymapPreset(string(f.Preset))
+		if err != nil {
+			return Keymap{}, fmt.Errorf("parse keymap %s: %w", path, err)
+		}
+	}
+
+	k := preset.Keymap()
+	// the names of the keys set by the file, which are case insensitive
+	names := map[rune]string{}
+	for name, key := range f.Keys {
+		r, size := utf8.DecodeRuneInString(name)
+		if name == "space" {
+			r, size = ' ', len(name)
+		}
+		if size == 0 || size != len(name) {
+			return Keymap{}, fmt.Errorf("parse keymap %s: invalid key %q, expected a character or space", path, name)
+		}
+		r = unicode.ToLower(r)
+		if other, ok := names[r]; ok {
+			return Keymap{}, fmt.Errorf("parse keymap %s: keys %q and %q are the same key", path, min(name, other), max(name, other))
+		}
+		names[r] = name
+		v, err := parseKey(key)
+		if err != nil {
+			return Keymap{}, fmt.Errorf("parse keymap %s: %w for %q", path, err, name)
+		}
+		k.Keys[r] = v
+	}
+
+	for _, buttons := range f.Gamepads {
+		m := GamepadMap{}
+		for b, key := range buttons {
+			if !slices.Contains(Buttons, b) {
+				return Keymap{}, fmt.Errorf("parse keymap %s: unknown gamepad button %q", path, b)
+			}
+			v, err := parseKey(key)
+			if err != nil {
+				return Keymap{}, fmt.Errorf("parse keymap %s: %w for %q", path, err, b)
+			}
+			m[b] = v
+		}
+		k.Gamepads = append(k.Gamepads, m)
+	}
+	return k, nil
+}
+
+// parseKey parses a CHIP-8 key written as a hex digit.
+func parseKey(s string) (uint8, error) {
+	v, err := strconv.ParseUint(s, 16, 4)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CHIP-8 key %q", s)
+	}
+	return uint8(v), nil
+}
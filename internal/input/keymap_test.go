@@ -0,0 +1,165 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeymapPresets(t *testing.T) {
+	tests := []struct {
+		preset KeymapPreset
+		keys   string // the keyboard keys of CHIP-8 keys 0 to F
+	}{
+		{HexKeymap, "0123456789abcdef"},
+		{COSMACKeymap, "x123qweasdzc4rfv"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.preset), func(t *testing.T) {
+			p, err := ParseKeymapPreset(string(tt.preset))
+			if err != nil || p != tt.preset {
+				t.Fatalf("got %v, %v", p, err)
+			}
+
+			k := p.Keymap()
+			if len(k.Keys) != 16 {
+				t.Fatalf("%d keys mapped", len(k.Keys))
+			}
+			for want, r := range tt.keys {
+				for _, r := range []rune{r, []rune(strings.ToUpper(string(r)))[0]} {
+					if got, ok := k.Key(r); !ok || got != uint8(want) {
+						t.Errorf("key %q: got %X, %v, want %X", r, got, ok, want)
+					}
+				}
+			}
+			if _, ok := k.Key('g'); ok {
+				t.Error("unmapped key g found")
+			}
+		})
+	}
+
+	if _, err := ParseKeymapPreset("dvorak"); err == nil || err.Error() != "unknown keymap: dvorak" {
+		t.Fatalf("got %v for an unknown preset", err)
+	}
+}
+
+func TestLoadKeymap(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		json string
+		// keys maps keyboard keys to the CHIP-8 key they should give, or -1
+		// when they shouldn't be mapped
+		keys map[rune]int
+		// buttons maps the buttons of the gamepads, by index, the same way
+		buttons map[int]map[Button]int
+		err     string
+	}{
+		{"empty", `{}`, map[rune]int{'0': 0x0, 'f': 0xF, 'x': -1}, nil, ""},
+		{"preset", `{"preset": "cosmac"}`, map[rune]int{'x': 0x0, 'v': 0xF, '0': -1}, nil, ""},
+		{"keys", `{"keys": {"j": "a", "K": "B"}}`, map[rune]int{'j': 0xA, 'k': 0xB, 'K': 0xB, '0': 0x0}, nil, ""},
+		{"override preset", `{"preset": "cosmac", "keys": {"x": "f"}}`, map[rune]int{'x': 0xF, 'v': 0xF}, nil, ""},
+		{"space", `{"keys": {"space": "5"}}`, map[rune]int{' ': 0x5}, nil, ""},
+		{"non-ascii", `{"keys": {"é": "1"}}`, map[rune]int{'é': 0x1, 'É': 0x1}, nil, ""},
+		{"same key twice", `{"keys": {"a": "1", "A": "2"}}`, nil, nil, `keys "A" and "a" are the same key`},
+		{"long key", `{"keys": {"ab": "1"}}`, nil, nil, `invalid key "ab", expected a character or space`},
+		{"empty key", `{"keys": {"": "1"}}`, nil, nil, `invalid key "", expected a character or space`},
+		{"key out of range", `{"keys": {"a": "10"}}`, nil, nil, `invalid CHIP-8 key "10" for "a"`},
+		{"key not hex", `{"keys": {"a": "g"}}`, nil, nil, `invalid CHIP-8 key "g" for "a"`},
+		{"unknown preset", `{"preset": "dvorak"}`, nil, nil, "unknown keymap: dvorak"},
+		{"invalid json", `{"keys": `, nil, nil, "unexpected end of JSON input"},
+		{"wrong type", `{"keys": {"a": 1}}`, nil, nil, "cannot unmarshal number"},
+
+		{"default gamepad", `{}`, nil, map[int]map[Button]int{
+			0: {ButtonUp: 0x2, ButtonDown: 0x8, ButtonLeft: 0x4, ButtonRight: 0x6, ButtonA: 0x5, ButtonB: 0x0, ButtonStart: -1},
+			3: {ButtonUp: 0x2, ButtonA: 0x5, ButtonX: -1},
+		}, ""},
+		{"gamepads", `{"gamepads": [{"dpup": "1", "a": "f"}, {"dpup": "c", "leftshoulder": "d"}]}`, nil, map[int]map[Button]int{
+			0: {ButtonUp: 0x1, ButtonA: 0xF, ButtonDown: -1, ButtonLeftShoulder: -1},
+			1: {ButtonUp: 0xC, ButtonLeftShoulder: 0xD, ButtonA: -1},
+			2: {ButtonUp: -1, ButtonA: -1},
+		}, ""},
+		{"gamepad and keys", `{"preset": "cosmac", "gamepads": [{"start": "0"}]}`, map[rune]int{'x': 0x0}, map[int]map[Button]int{
+			0: {ButtonStart: 0x0, ButtonUp: -1},
+		}, ""},
+		{"unknown button", `{"gamepads": [{"dpup": "1"}, {"z": "1"}]}`, nil, nil, `unknown gamepad button "z"`},
+		{"sdl name case", `{"gamepads": [{"DPUP": "1"}]}`, nil, nil, `unknown gamepad button "DPUP"`},
+		{"button key out of range", `{"gamepads": [{"a": "1f"}]}`, nil, nil, `invalid CHIP-8 key "1f" for "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			k, err := LoadKeymap(path)
+			if tt.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), "parse keymap "+path+": ") || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for r, want := range tt.keys {
+				got, ok := k.Key(r)
+				if want < 0 && ok {
+					t.Errorf("key %q mapped to %X", r, got)
+				}
+				if want >= 0 && (!ok || int(got) != want) {
+					t.Errorf("key %q: got %X, %v, want %X", r, got, ok, want)
+				}
+			}
+			for pad, buttons := range tt.buttons {
+				for b, want := range buttons {
+					got, ok := k.Button(pad, b)
+					if want < 0 && ok {
+						t.Errorf("gamepad %d %s mapped to %X", pad, b, got)
+					}
+					if want >= 0 && (!ok || int(got) != want) {
+						t.Errorf("gamepad %d %s: got %X, %v, want %X", pad, b, got, ok, want)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := LoadKeymap(filepath.Join(dir, "missing.json")); err == nil || !strings.HasPrefix(err.Error(), "read keymap: ") {
+		t.Fatalf("got %v for a missing file", err)
+	}
+}
+
+func TestButtons(t *testing.T) {
+	// every button name can be mapped, as SDL names it
+	sdlNames := []string{
+		"a", "b", "x", "y", "back", "guide", "start", "leftstick", "rightstick",
+		"leftshoulder", "rightshoulder", "dpup", "dpdown", "dpleft", "dpright",
+	}
+	if len(sdlNames) != len(Buttons) {
+		t.Fatalf("%d buttons, want %d", len(Buttons), len(sdlNames))
+	}
+
+	var entries []string
+	for i, name := range sdlNames {
+		entries = append(entries, fmt.Sprintf("%q: \"%x\"", name, i))
+	}
+	path := filepath.Join(t.TempDir(), "buttons.json")
+	data := `{"gamepads": [{` + strings.Join(entries, ", ") + `}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := LoadKeymap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range sdlNames {
+		if got, ok := k.Button(0, Button(name)); !ok || int(got) != i {
+			t.Errorf("%s: got %X, %v, want %X", name, got, ok, i)
+		}
+	}
+}
@@ -1,5 +1,29 @@
 package sound
 
+import "math"
+
+// Pattern is an XO-CHIP audio pattern: 128 1-bit samples played in a loop
+// at a rate derived from Pitch.
+type Pattern struct {
+	Buffer [16]uint8
+	Pitch  uint8
+}
+
+// DefaultPitch plays the pattern back at 4000 samples per second.
+const DefaultPitch = 64
+
+// Rate returns the playback rate of the pattern in samples per second.
+func (p Pattern) Rate() float64 {
+	return 4000 * math.Pow(2, (float64(p.Pitch)-64)/48)
+}
+
+// Sample returns the i-th 1-bit sample of the pattern.
+func (p Pattern) Sample(i int) bool {
+	i %= len(p.Buffer) * 8
+	return p.Buffer[i/8]&(0x80>>(i%8)) != 0
+}
+
 type Manager interface {
 	Buzz() error
+	SetPattern(p Pattern) error
 }
@@ -1,20 +1,86 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 
+	"github.com/ruggi/c8/internal/assembler"
 	"github.com/ruggi/c8/internal/backend"
+	"github.com/ruggi/c8/internal/backend/terminal"
+	"github.com/ruggi/c8/internal/conformance"
+	"github.com/ruggi/c8/internal/disasm"
+	"github.com/ruggi/c8/internal/display"
 	"github.com/ruggi/c8/internal/emulator"
+	"github.com/ruggi/c8/internal/input"
 	"github.com/urfave/cli"
 )
 
 var config struct {
 	romFile    string
 	backend    string
+	termMode   string
+	termKeys   string
+	keymap     string
+	palette    string
 	cpuRate    int
+	ipf        int
 	renderRate int
+	platform   string
+	loadAddr   string
+	rewind     int
+	debug      bool
+	breaks     cli.StringSlice
+	breakLines cli.IntSlice
+	watches    cli.StringSlice
+	watchLog   string
+	trace      string
+	traceFmt   string
+	onFault    string
+}
+
+var disasmConfig struct {
+	syntax   string
+	platform string
+	output   string
+}
+
+var asmConfig struct {
+	output string
+}
+
+var testConfig struct {
+	suiteDir string
+	golden   string
+	manifest string
+	ipf      int
+	update   bool
+}
+
+// quirkFlags are the flags overriding the quirks of the selected platform.
+var quirkFlags = []struct {
+	name  string
+	usage string
+	quirk func(q *emulator.Quirks) *bool
+}{
+	{"quirk-vf-reset", "Reset VF after 8XY1, 8XY2 and 8XY3", func(q *emulator.Quirks) *bool { return &q.VFReset }},
+	{"quirk-memory", "Increment I after FX55 and FX65", func(q *emulator.Quirks) *bool { return &q.Memory }},
+	{"quirk-shifting", "Shift Vx in place in 8XY6 and 8XYE", func(q *emulator.Quirks) *bool { return &q.Shifting }},
+	{"quirk-jumping", "Jump to XNN + Vx in BNNN", func(q *emulator.Quirks) *bool { return &q.Jumping }},
+	{"quirk-clipping", "Clip sprites at the screen edges", func(q *emulator.Quirks) *bool { return &q.Clipping }},
+	{"quirk-half-scroll", "Scroll by half the distance in low resolution", func(q *emulator.Quirks) *bool { return &q.HalfScroll }},
+	{"quirk-collision-rows", "Count collided rows in VF in high resolution", func(q *emulator.Quirks) *bool { return &q.CollisionRows }},
+	{"quirk-display-wait", "Wait for the next 60Hz frame after DXYN", func(q *emulator.Quirks) *bool { return &q.DisplayWait }},
 }
 
 func main() {
@@ -24,30 +90,195 @@ func main() {
 	app.Flags = []cli.Flag{
 		&cli.StringFlag{
 			Name:        "f,rom-file",
-			Usage:       "The filename of the Chip-8 ROM to run",
+			Usage:       "The filename of the Chip-8 ROM to run (.8o files are assembled first)",
 			Destination: &config.romFile,
-			Required:    true,
 		},
 		&cli.StringFlag{
 			Name:        "b,backend",
-			Usage:       "The backend to use (sdl, terminal)",
+			Usage:       "The backend to use (sdl, terminal, headless)",
 			Destination: &config.backend,
 			Value:       string(backend.SDL),
 		},
+		&cli.StringFlag{
+			Name:        "keymap",
+			Usage:       "The keymap preset (hex, cosmac) or JSON file to use (default: the ROM's .keymap.json file if any, hex otherwise)",
+			Destination: &config.keymap,
+		},
+		&cli.StringFlag{
+			Name:        "palette",
+			Usage:       "The colours to draw with: a theme (classic, amber, green, lcd, octo), 2 or 4 comma separated #RRGGBB colours or a JSON file (default: the ROM's .palette.json file if any, classic otherwise)",
+			Destination: &config.palette,
+		},
+		&cli.StringFlag{
+			Name:        "terminal-mode",
+			Usage:       "How the terminal backend draws pixels (block, half, quadrant, braille)",
+			Destination: &config.termMode,
+			Value:       string(terminal.ModeHalf),
+		},
+		&cli.StringFlag{
+			Name:        "terminal-keyboard",
+			Usage:       "How the terminal backend tells key releases (auto, timeout)",
+			Destination: &config.termKeys,
+			Value:       string(terminal.KeyboardAuto),
+		},
 		&cli.IntFlag{
 			Name:        "c,cpu-rate",
 			Usage:       "The CPU rate in Hz",
 			Destination: &config.cpuRate,
 			Value:       600,
 		},
+		&cli.IntFlag{
+			Name:        "ipf",
+			Usage:       "Execute the given number of instructions per 60Hz frame instead of running at the CPU rate",
+			Destination: &config.ipf,
+		},
 		&cli.IntFlag{
 			Name:        "r,render-rate",
 			Usage:       "The render rate in Hz",
 			Destination: &config.renderRate,
 			Value:       60,
 		},
+		&cli.IntFlag{
+			Name:        "rewind",
+			Usage:       "How many seconds can be rewound by holding backspace (0 to disable)",
+			Destination: &config.rewind,
+			Value:       30,
+		},
+		&cli.BoolFlag{
+			Name:        "debug",
+			Usage:       "Enable the debugger (F8 pause/resume, F10 step over, F11 step, F4 toggle breakpoint)",
+			Destination: &config.debug,
+		},
+		&cli.StringSliceFlag{
+			Name:  "break",
+			Usage: "Add a debugger breakpoint at the given address, e.g. 0x2A0 (implies --debug)",
+			Value: &config.breaks,
+		},
+		&cli.IntSliceFlag{
+			Name:  "break-line",
+			Usage: "Add a debugger breakpoint at the given line of a .8o source file (implies --debug)",
+			Value: &config.breakLines,
+		},
+		&cli.StringSliceFlag{
+			Name:  "watch",
+			Usage: "Add a memory watchpoint as <start>[-<end>]:<rwx>[:log], e.g. 0x300-0x30F:w (breaking ones imply --debug)",
+			Value: &config.watches,
+		},
+		&cli.StringFlag{
+			Name:        "watch-log",
+			Usage:       "The file logging watchpoints write to, required with the terminal backend (default: stderr)",
+			Destination: &config.watchLog,
+		},
+		&cli.StringFlag{
+			Name:        "trace",
+			Usage:       "Write a record of every executed instruction to the given file",
+			Destination: &config.trace,
+		},
+		&cli.StringFlag{
+			Name:        "trace-format",
+			Usage:       "The format of the trace (text, binary)",
+			Destination: &config.traceFmt,
+			Value:       string(emulator.TraceText),
+		},
+		&cli.StringFlag{
+			Name:        "on-fault",
+			Usage:       "What to do when the CPU faults (halt, ignore, debug)",
+			Destination: &config.onFault,
+			Value:       string(emulator.FaultHalt),
+		},
+		&cli.StringFlag{
+			Name:        "p,platform",
+			Usage:       "The platform to emulate (vip, schip-legacy, schip-modern, xochip, eti660)",
+			Destination: &config.platform,
+			Value:       string(emulator.VIP),
+		},
+		&cli.StringFlag{
+			Name:        "load-address",
+			Usage:       "The address the ROM is loaded at and started from, e.g. 0x600 (default: 0x600 for eti660, 0x200 otherwise)",
+			Destination: &config.loadAddr,
+		},
+	}
+	for _, q := range quirkFlags {
+		app.Flags = append(app.Flags, &cli.BoolFlag{
+			Name:  q.name,
+			Usage: q.usage + " (overrides the platform default, use =false to disable)",
+		})
 	}
 	app.Action = run
+	app.Commands = []cli.Command{
+		{
+			Name:  "test",
+			Usage: "Run the conformance test ROMs headlessly and compare against golden hashes",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "s,suite-dir",
+					Usage:       "The directory containing the test ROMs",
+					Destination: &testConfig.suiteDir,
+					Required:    true,
+				},
+				&cli.StringFlag{
+					Name:        "g,golden",
+					Usage:       "A JSON file of golden hashes to use instead of the bundled Timendus suite ones",
+					Destination: &testConfig.golden,
+				},
+				&cli.StringFlag{
+					Name:        "m,manifest",
+					Usage:       "A JSON manifest to use instead of the bundled Timendus suite one",
+					Destination: &testConfig.manifest,
+				},
+				&cli.IntFlag{
+					Name:        "ipf",
+					Usage:       "The number of instructions executed per frame",
+					Destination: &testConfig.ipf,
+					Value:       1000,
+				},
+				&cli.BoolFlag{
+					Name:        "u,update",
+					Usage:       "Write the hashes to the golden file instead of comparing against them",
+					Destination: &testConfig.update,
+				},
+			},
+			Action: runTests,
+		},
+		{
+			Name:      "disasm",
+			Usage:     "Disassemble a ROM into a labelled listing",
+			ArgsUsage: "<rom-file>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "s,syntax",
+					Usage:       "The syntax of the listing (classic, octo)",
+					Destination: &disasmConfig.syntax,
+					Value:       string(emulator.Classic),
+				},
+				&cli.StringFlag{
+					Name:        "p,platform",
+					Usage:       "The platform the ROM was written for (vip, schip-legacy, schip-modern, xochip, eti660)",
+					Destination: &disasmConfig.platform,
+					Value:       string(emulator.VIP),
+				},
+				&cli.StringFlag{
+					Name:        "o,output",
+					Usage:       "The file to write the listing to (default: stdout)",
+					Destination: &disasmConfig.output,
+				},
+			},
+			Action: runDisasm,
+		},
+		{
+			Name:      "asm",
+			Usage:     "Assemble Octo source into a ROM",
+			ArgsUsage: "<source-file>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:        "o,output",
+					Usage:       "The file to write the ROM to (default: the source file with a .ch8 extension)",
+					Destination: &asmConfig.output,
+				},
+			},
+			Action: runAsm,
+		},
+	}
 
 	err := app.Run(os.Args)
 	if err != nil {
@@ -56,19 +287,381 @@ func main() {
 }
 
 func run(ctx *cli.Context) error {
-	rom, err := os.ReadFile(config.romFile)
+	if config.romFile == "" {
+		return fmt.Errorf("missing ROM file, use -f <rom-file>")
+	}
+
+	rom, prog, src, err := readROM(config.romFile)
 	if err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+		return err
+	}
+
+	platform, err := emulator.ParsePlatform(config.platform)
+	if err != nil {
+		return err
+	}
+
+	clock := emulator.Clock{
+		CPURate:              config.cpuRate,
+		InstructionsPerFrame: config.ipf,
+		RenderRate:           config.renderRate,
+	}
+	if err := clock.Validate(); err != nil {
+		return err
+	}
+
+	onFault, err := emulator.ParseFaultPolicy(config.onFault)
+	if err != nil {
+		return err
+	}
+
+	loadAddr := platform.LoadAddress()
+	if config.loadAddr != "" {
+		addr, err := strconv.ParseUint(config.loadAddr, 0, 16)
+		if err != nil || addr == 0 {
+			return fmt.Errorf("invalid load address %q", config.loadAddr)
+		}
+		loadAddr = uint16(addr)
+	}
+	if prog != nil && loadAddr != assembler.Origin {
+		return fmt.Errorf(".8o sources are assembled for %#x, not %#x", assembler.Origin, loadAddr)
+	}
+	// checked before the backend takes over the terminal
+	if err := emulator.CheckROM(rom, platform, loadAddr); err != nil {
+		return err
+	}
+
+	quirks := platform.Quirks()
+	for _, q := range quirkFlags {
+		if ctx.IsSet(q.name) {
+			*q.quirk(&quirks) = ctx.Bool(q.name)
+		}
+	}
+
+	var breakpoints []uint16
+	for _, s := range config.breaks {
+		addr, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return fmt.Errorf("invalid breakpoint %q: %w", s, err)
+		}
+		breakpoints = append(breakpoints, uint16(addr))
+	}
+	for _, line := range config.breakLines {
+		if prog == nil {
+			return fmt.Errorf("line breakpoints need a .8o source file")
+		}
+		addr, ok := prog.LineAddr(line)
+		if !ok {
+			return fmt.Errorf("no code at or after line %d", line)
+		}
+		breakpoints = append(breakpoints, addr)
+	}
+
+	var watchpoints []emulator.Watchpoint
+	debug := config.debug || len(breakpoints) > 0
+	logging := false
+	for _, s := range config.watches {
+		wp, err := emulator.ParseWatchpoint(s)
+		if err != nil {
+			return err
+		}
+		watchpoints = append(watchpoints, wp)
+		debug = debug || wp.Break
+		logging = logging || !wp.Break
+	}
+
+	watchLog := io.Writer(os.Stderr)
+	if config.watchLog != "" {
+		f, err := os.Create(config.watchLog)
+		if err != nil {
+			return fmt.Errorf("error creating watch log: %w", err)
+		}
+		defer f.Close()
+		watchLog = f
+	} else if logging && backend.Type(config.backend) == backend.Terminal {
+		// stderr would be drawn over the screen
+		return fmt.Errorf("logging watchpoints need --watch-log with the terminal backend")
+	}
+
+	var trace io.Writer
+	traceFormat := emulator.TraceFormat(config.traceFmt)
+	switch traceFormat {
+	case emulator.TraceText, emulator.TraceBinary:
+	default:
+		return fmt.Errorf("unknown trace format: %s", traceFormat)
+	}
+	if config.trace != "" {
+		f, err := os.Create(config.trace)
+		if err != nil {
+			return fmt.Errorf("error creating trace: %w", err)
+		}
+		defer f.Close()
+		trace = f
+	}
+
+	termMode, err := terminal.ParseMode(config.termMode)
+	if err != nil {
+		return err
+	}
+	termKeys, err := terminal.ParseKeyboard(config.termKeys)
+	if err != nil {
+		return err
+	}
+
+	keymap, err := loadKeymap(config.keymap, config.romFile)
+	if err != nil {
+		return err
+	}
+
+	palette, err := loadPalette(config.palette, config.romFile)
+	if err != nil {
+		return err
 	}
 
-	b, err := backend.New(backend.Type(config.backend), ctx.App.Name)
+	b, err := backend.New(backend.Type(config.backend), ctx.App.Name, backend.Config{
+		Keymap:   keymap,
+		Palette:  palette,
+		Terminal: terminal.Options{Mode: termMode, Keyboard: termKeys},
+	})
 	if err != nil {
 		return fmt.Errorf("error initializing draw: %w", err)
 	}
 	defer b.Close()
 
-	e := emulator.New(b)
-	e.Load(rom)
+	e := emulator.New(b, emulator.Options{
+		Platform:      platform,
+		Quirks:        quirks,
+		LoadAddress:   loadAddr,
+		StatePath:     config.romFile,
+		RewindSeconds: config.rewind,
+		Debug:         debug,
+		Breakpoints:   breakpoints,
+		Watchpoints:   watchpoints,
+		WatchLog:      watchLog,
+		Source:        src,
+		Trace:         trace,
+		TraceFormat:   traceFormat,
+		OnFault:       onFault,
+	})
+	err = e.Load(rom)
+	if err != nil {
+		return err
+	}
+
+	// stop gracefully on interrupt, so that the backend is closed
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = e.Run(runCtx, b, clock)
+	// flush the trace before its file is closed
+	closeErr := e.Close()
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("cpu fault: %w", err)
+	}
+	return closeErr
+}
+
+func runTests(ctx *cli.Context) error {
+	manifest, err := conformance.DefaultManifest()
+	if testConfig.manifest != "" {
+		manifest, err = conformance.LoadManifest(testConfig.manifest)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := emulator.ValidateFrames(testConfig.ipf); err != nil {
+		return err
+	}
+	if testConfig.update && testConfig.golden == "" {
+		return fmt.Errorf("--update needs the golden file to write with --golden")
+	}
+	golden, err := conformance.DefaultGolden()
+	if testConfig.golden != "" {
+		golden, err = conformance.LoadGolden(testConfig.golden)
+		if errors.Is(err, fs.ErrNotExist) && testConfig.update {
+			golden, err = conformance.Golden{}, nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(golden) == 0 && !testConfig.update {
+		return fmt.Errorf("no golden hashes to compare against, record them with --golden <file> --update")
+	}
+
+	runner := conformance.Runner{
+		SuiteDir:             testConfig.suiteDir,
+		Golden:               golden,
+		InstructionsPerFrame: testConfig.ipf,
+		Update:               testConfig.update,
+	}
+	results := runner.Run(manifest)
+	conformance.WriteTable(os.Stdout, results)
+
+	if testConfig.update {
+		err := golden.Save(testConfig.golden)
+		if err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d of %d tests failed", failed, len(results)), 1)
+	}
+	return nil
+}
+
+func runDisasm(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected a single ROM file")
+	}
+
+	rom, err := os.ReadFile(ctx.Args().First())
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	platform, err := emulator.ParsePlatform(disasmConfig.platform)
+	if err != nil {
+		return err
+	}
 
-	return e.Run(b, config.cpuRate, config.renderRate)
+	syntax := emulator.Syntax(disasmConfig.syntax)
+	switch syntax {
+	case emulator.Classic, emulator.Octo:
+	default:
+		return fmt.Errorf("unknown syntax: %s", syntax)
+	}
+
+	// listed in memory first, not to leave an empty output behind on errors
+	var listing bytes.Buffer
+	err = disasm.Disassemble(&listing, rom, disasm.Options{
+		Syntax:   syntax,
+		Platform: platform,
+		Origin:   platform.LoadAddress(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if disasmConfig.output == "" {
+		_, err = os.Stdout.Write(listing.Bytes())
+		return err
+	}
+	err = os.WriteFile(disasmConfig.output, listing.Bytes(), 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return nil
+}
+
+func runAsm(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("expected a single source file")
+	}
+	source := ctx.Args().First()
+
+	prog, _, err := assemble(source)
+	if err != nil {
+		return err
+	}
+
+	output := asmConfig.output
+	if output == "" {
+		output = strings.TrimSuffix(source, filepath.Ext(source)) + ".ch8"
+	}
+	err = os.WriteFile(output, prog.ROM, 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing ROM: %w", err)
+	}
+	return nil
+}
+
+// readROM reads a ROM file, assembling it first if it's Octo source. The
+// assembled program is returned too, with its source for the debugger.
+func readROM(path string) ([]byte, *assembler.Program, *emulator.Source, error) {
+	if filepath.Ext(path) == ".8o" {
+		prog, src, err := assemble(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return prog.ROM, prog, source(prog, src), nil
+	}
+	rom, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading file: %w", err)
+	}
+	return rom, nil, nil, nil
+}
+
+func assemble(path string) (*assembler.Program, string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading file: %w", err)
+	}
+	prog, err := assembler.Assemble(string(src))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return prog, string(src), nil
+}
+
+// source maps an assembled program back to its source for the debugger.
+func source(prog *assembler.Program, src string) *emulator.Source {
+	s := &emulator.Source{
+		Lines:  strings.Split(strings.TrimSuffix(src, "\n"), "\n"),
+		Map:    prog.Lines,
+		Labels: map[uint16]string{},
+	}
+	for name, addr := range prog.Labels {
+		s.Labels[addr] = name
+	}
+	return s
+}
+
+// loadKeymap returns the keymap preset or file with the given name. Without
+// a name, the keymap file next to the ROM is used if there is one, e.g.
+// pong.keymap.json for pong.ch8.
+func loadKeymap(name, romFile string) (input.Keymap, error) {
+	if name == "" {
+		path := strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".keymap.json"
+		if _, err := os.Stat(path); err != nil {
+			return input.HexKeymap.Keymap(), nil
+		}
+		name = path
+	}
+	if preset, err := input.ParseKeymapPreset(name); err == nil {
+		return preset.Keymap(), nil
+	}
+	if filepath.Ext(name) != ".json" {
+		return input.Keymap{}, fmt.Errorf("unknown keymap %q, expected a preset (hex, cosmac) or a JSON file", name)
+	}
+	return input.LoadKeymap(name)
+}
+
+// loadPalette returns the palette with the given name, colours or file.
+// Without any, the palette file next to the ROM is used if there is one,
+// e.g. pong.palette.json for pong.ch8.
+func loadPalette(name, romFile string) (display.Palette, error) {
+	if name == "" {
+		path := strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".palette.json"
+		if _, err := os.Stat(path); err != nil {
+			return display.Classic.Palette(), nil
+		}
+		name = path
+	}
+	if filepath.Ext(name) == ".json" {
+		return display.LoadPalette(name)
+	}
+	return display.ParsePalette(name)
 }